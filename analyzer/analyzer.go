@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/token"
+	"sort"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found in a program before it's evaluated
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Analyze checks a parsed program for mistakes that would otherwise only show
+// up at runtime, if at all. The diagnostics are sorted by position.
+func Analyze(program *ast.Program) []Diagnostic {
+	a := &analyzer{scope: newScope(nil)}
+	ast.Walk(a, program)
+	a.resolve()
+
+	sort.SliceStable(a.diagnostics, func(i, j int) bool {
+		return a.diagnostics[i].Pos.Before(a.diagnostics[j].Pos)
+	})
+	return a.diagnostics
+}
+
+// HasErrors reports whether any of the diagnostics is an error rather than a warning
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// functions get a scope of their own, as does the handler of a try expression;
+// other blocks share the scope they're in
+type scope struct {
+	outer *scope
+	names map[string]bool
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: make(map[string]bool)}
+}
+
+func (s *scope) lookup(name string) bool {
+	for current := s; current != nil; current = current.outer {
+		if current.names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+type reference struct {
+	scope *scope
+	ident *ast.Identifier
+}
+
+// references are resolved once the whole program has been seen, because
+// function bodies may refer to bindings declared after them
+type analyzer struct {
+	scope       *scope
+	references  []reference
+	diagnostics []Diagnostic
+}
+
+func (a *analyzer) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		a.checkUnreachable(node.Statements)
+
+	case *ast.BlockStatement:
+		a.checkUnreachable(node.Statements)
+
+	case *ast.LetStatement:
+		ast.Walk(a, node.Value)
+		if node.Pattern != nil {
+			for _, name := range node.Pattern.Names() {
+				a.scope.names[name.Value] = true
+			}
+		} else {
+			a.scope.names[node.Name.Value] = true
+		}
+		return nil
+
+	case *ast.EnumStatement:
+		a.scope.names[node.Name.Value] = true
+		return nil
+
+	case *ast.FunctionStatement:
+		a.scope.names[node.Name.Value] = true
+		ast.Walk(a, node.Function)
+		return nil
+
+	case *ast.FunctionLiteralExpression:
+		inner := &analyzer{scope: newScope(a.scope)}
+		for _, param := range node.Parameters {
+			if inner.scope.names[param.Value] {
+				inner.report(param.Pos(), Error, "duplicate parameter %s", param.Value)
+			}
+			inner.scope.names[param.Value] = true
+		}
+		ast.Walk(inner, node.Body)
+		a.merge(inner)
+		return nil
+
+	case *ast.TryExpression:
+		ast.Walk(a, node.Body)
+		inner := &analyzer{scope: newScope(a.scope)}
+		inner.scope.names[node.Param.Value] = true
+		ast.Walk(inner, node.Handler)
+		a.merge(inner)
+		return nil
+
+	case *ast.AccessExpression:
+		// the key is a field name rather than a reference
+		ast.Walk(a, node.Target)
+		return nil
+
+	case *ast.HashLiteral:
+		a.checkDuplicateKeys(node)
+
+	case *ast.Identifier:
+		a.references = append(a.references, reference{scope: a.scope, ident: node})
+	}
+
+	return a
+}
+
+func (a *analyzer) merge(inner *analyzer) {
+	a.references = append(a.references, inner.references...)
+	a.diagnostics = append(a.diagnostics, inner.diagnostics...)
+}
+
+func (a *analyzer) report(pos token.Position, severity Severity, format string, args ...interface{}) {
+	a.diagnostics = append(a.diagnostics, Diagnostic{Pos: pos, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (a *analyzer) resolve() {
+	for _, ref := range a.references {
+		if !ref.scope.lookup(ref.ident.Value) && !evaluator.IsBuiltin(ref.ident.Value) {
+			a.report(ref.ident.Pos(), Error, "undefined: %s", ref.ident.Value)
+		}
+	}
+}
+
+func (a *analyzer) checkUnreachable(statements []ast.Statement) {
+	for i, stmt := range statements[:max(len(statements)-1, 0)] {
+		var keyword string
+		switch stmt.(type) {
+		case *ast.ReturnStatement:
+			keyword = "return"
+		case *ast.ThrowStatement:
+			keyword = "throw"
+		case *ast.BreakStatement:
+			keyword = "break"
+		case *ast.ContinueStatement:
+			keyword = "continue"
+		default:
+			continue
+		}
+		a.report(statements[i+1].Pos(), Warning, "unreachable code after %s", keyword)
+		return
+	}
+}
+
+// only literal keys are compared; computed keys are only known at runtime
+func (a *analyzer) checkDuplicateKeys(hash *ast.HashLiteral) {
+	seen := make(map[string]bool)
+	for _, pair := range hash.Pairs {
+		var constant string
+		switch key := pair.Key.(type) {
+		case *ast.StringLiteral:
+			constant = fmt.Sprintf("%q", key.Value)
+		case *ast.IntegerLiteral:
+			constant = fmt.Sprintf("%d", key.Value)
+		case *ast.BooleanExpression:
+			constant = fmt.Sprintf("%t", key.Value)
+		default:
+			continue
+		}
+
+		if seen[constant] {
+			a.report(pair.Key.Pos(), Warning, "duplicate key %s in hash literal", constant)
+		}
+		seen[constant] = true
+	}
+}
@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; x", []string{}},
+		{"len([1]); puts(x)", []string{"1:16: error: undefined: x"}},
+		{"let f = fn(a, b, a) { a };", []string{"1:18: error: duplicate parameter a"}},
+		{"fn f(a, a) { a }", []string{"1:9: error: duplicate parameter a"}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", []string{}},
+		{"let f = fn() { let y = 2; }; y", []string{"1:30: error: undefined: y"}},
+		{"if (true) { let y = 2; }; y", []string{}},
+		{"try { 1 } catch (e) { e }; e", []string{"1:28: error: undefined: e"}},
+		{"let [a, b] = [1, 2]; let {c} = {\"c\": 3}; a + b + c", []string{}},
+		{"enum Color { Red } Color.Red; Color.Blue", []string{}},
+		{"x = 1", []string{"1:1: error: undefined: x"}},
+		{
+			`{"a": 1, "b": 2, "a": 3}`,
+			[]string{`1:18: warning: duplicate key "a" in hash literal`},
+		},
+		{`{1: 1, "1": 2, true: 3, true: 4}`, []string{"1:25: warning: duplicate key true in hash literal"}},
+		{`let k = "a"; {k: 1, k: 2}`, []string{}},
+		{"let f = fn() { return 1; 2 }; f()", []string{"1:26: warning: unreachable code after return"}},
+		{"while (true) { break; 1 }", []string{"1:23: warning: unreachable code after break"}},
+		{
+			"let f = fn(a, a) { return a; b };",
+			[]string{"1:15: error: duplicate parameter a", "1:30: warning: unreachable code after return", "1:30: error: undefined: b"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Analyze(program)
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("Unexpected number of diagnostics for %q. expected=%v got=%v", tt.input, tt.expected, diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("Unexpected diagnostic for %q. expected=%q got=%q", tt.input, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	if HasErrors([]Diagnostic{{Severity: Warning}}) {
+		t.Errorf("warnings aren't errors")
+	}
+	if !HasErrors([]Diagnostic{{Severity: Warning}, {Severity: Error}}) {
+		t.Errorf("expected an error to be found")
+	}
+}
@@ -10,6 +10,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // the first char of the node
+	End() token.Position // just after the last char of the node
 }
 
 type Statement interface {
@@ -25,6 +27,7 @@ type Expression interface {
 // program
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // only collected when the lexer emits comments
 }
 
 func (p *Program) TokenLiteral() string {
@@ -35,6 +38,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -47,30 +64,110 @@ func (p *Program) String() string {
 
 // let
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern // set instead of Name when destructuring
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos() }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Pattern != nil {
+		return ls.Pattern.End()
+	}
+	return endOf(ls.Name, ls.Token)
+}
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral())
 	out.WriteString(" ")
-	out.WriteString(ls.Name.String())
-	out.WriteString(" = ")
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	if ls.Value != nil {
+		out.WriteString(" = ")
 		out.WriteString(ls.Value.String())
-	} else {
-		out.WriteString("nil")
 	}
 	out.WriteString(";")
 
 	return out.String()
 }
 
+// destructuring patterns on the left-hand side of a let
+type Pattern interface {
+	Node
+	patternNode()
+	Names() []*Identifier
+}
+
+// let [a, b] = ...
+type ArrayPattern struct {
+	Token    token.Token // the [ token
+	Elements []*Identifier
+	Rbracket token.Token // the ] token
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos() }
+func (ap *ArrayPattern) End() token.Position  { return ap.Rbracket.End() }
+func (ap *ArrayPattern) Names() []*Identifier { return ap.Elements }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ",") + "]"
+}
+
+// let {name, age} = ...
+type HashPattern struct {
+	Token  token.Token // the { token
+	Keys   []*Identifier
+	Rbrace token.Token // the } token
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos() }
+func (hp *HashPattern) End() token.Position  { return hp.Rbrace.End() }
+func (hp *HashPattern) Names() []*Identifier { return hp.Keys }
+func (hp *HashPattern) String() string {
+	keys := []string{}
+	for _, key := range hp.Keys {
+		keys = append(keys, key.String())
+	}
+	return "{" + strings.Join(keys, ",") + "}"
+}
+
+// enum Color { Red, Green, Blue }
+type EnumStatement struct {
+	Token    token.Token // the ENUM token
+	Name     *Identifier
+	Variants []*Identifier
+	Rbrace   token.Token // the } token
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Position  { return es.Token.Pos() }
+func (es *EnumStatement) End() token.Position  { return es.Rbrace.End() }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, variant := range es.Variants {
+		variants = append(variants, variant.String())
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
 // return
 type ReturnStatement struct {
 	Token       token.Token
@@ -79,6 +176,8 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *ReturnStatement) End() token.Position  { return endOf(rs.ReturnValue, rs.Token) }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral())
@@ -92,6 +191,29 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// throw
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos() }
+func (ts *ThrowStatement) End() token.Position  { return endOf(ts.Value, ts.Token) }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral())
+	out.WriteString(" ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	} else {
+		out.WriteString("nil")
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 // expression statement
 type ExpressionStatement struct {
 	Token      token.Token // the first token in the expression
@@ -100,6 +222,8 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return posOf(es.Expression, es.Token) }
+func (es *ExpressionStatement) End() token.Position  { return endOf(es.Expression, es.Token) }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -115,6 +239,8 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos() }
+func (i *Identifier) End() token.Position  { return i.Token.End() }
 func (i *Identifier) String() string       { return i.Value }
 
 // integer literal
@@ -125,8 +251,22 @@ type IntegerLiteral struct {
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos() }
+func (i *IntegerLiteral) End() token.Position  { return i.Token.End() }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+// float literal
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos() }
+func (f *FloatLiteral) End() token.Position  { return f.Token.End() }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
 // prefix expression
 type PrefixExpression struct {
 	Token    token.Token
@@ -136,6 +276,8 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos() }
+func (pe *PrefixExpression) End() token.Position  { return endOf(pe.Right, pe.Token) }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -157,6 +299,8 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return posOf(ie.Left, ie.Token) }
+func (ie *InfixExpression) End() token.Position  { return endOf(ie.Right, ie.Token) }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -179,16 +323,36 @@ type BooleanExpression struct {
 
 func (be *BooleanExpression) expressionNode()      {}
 func (be *BooleanExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BooleanExpression) Pos() token.Position  { return be.Token.Pos() }
+func (be *BooleanExpression) End() token.Position  { return be.Token.End() }
 func (be *BooleanExpression) String() string       { return be.Token.Literal }
 
+// assignment to an existing binding
+type AssignExpression struct {
+	Token token.Token // the = token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return posOf(ae.Name, ae.Token) }
+func (ae *AssignExpression) End() token.Position  { return endOf(ae.Value, ae.Token) }
+func (ae *AssignExpression) String() string {
+	return fmt.Sprintf("%s = %s", ae.Name.String(), ae.Value.String())
+}
+
 // Block statement
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Token // the } token
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos() }
+func (bs *BlockStatement) End() token.Position  { return bs.Rbrace.End() }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -207,6 +371,13 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos() }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	return endOf(ie.Consequence, ie.Token)
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -222,15 +393,124 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// while loop
+type WhileExpression struct {
+	Token     token.Token // the WHILE token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (we *WhileExpression) expressionNode()      {}
+func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) Pos() token.Position  { return we.Token.Pos() }
+func (we *WhileExpression) End() token.Position  { return endOf(we.Body, we.Token) }
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while ")
+	out.WriteString(we.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(we.Body.String())
+
+	return out.String()
+}
+
+// try { ... } catch (e) { ... }
+type TryExpression struct {
+	Token   token.Token // the TRY token
+	Body    *BlockStatement
+	Param   *Identifier
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos() }
+func (te *TryExpression) End() token.Position  { return endOf(te.Handler, te.Token) }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	out.WriteString(" catch (")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
+// delay(expr), evaluated lazily by force()
+type DelayExpression struct {
+	Token  token.Token // the DELAY token
+	Value  Expression
+	Rparen token.Token // the ) token
+}
+
+func (de *DelayExpression) expressionNode()      {}
+func (de *DelayExpression) TokenLiteral() string { return de.Token.Literal }
+func (de *DelayExpression) Pos() token.Position  { return de.Token.Pos() }
+func (de *DelayExpression) End() token.Position  { return de.Rparen.End() }
+func (de *DelayExpression) String() string       { return "delay(" + de.Value.String() + ")" }
+
+// yield value, suspends a generator
+type YieldExpression struct {
+	Token token.Token // the YIELD token
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) Pos() token.Position  { return ye.Token.Pos() }
+func (ye *YieldExpression) End() token.Position  { return endOf(ye.Value, ye.Token) }
+func (ye *YieldExpression) String() string       { return "yield " + ye.Value.String() }
+
+// spawn f(x), runs the call concurrently
+type SpawnExpression struct {
+	Token token.Token // the SPAWN token
+	Call  *FunctionCallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SpawnExpression) End() token.Position  { return endOf(se.Call, se.Token) }
+func (se *SpawnExpression) String() string       { return "spawn " + se.Call.String() }
+
+// break
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos() }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End() }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+// continue
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos() }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End() }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
 // Function literal
 type FunctionLiteralExpression struct {
 	Token      token.Token // the IF token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Generator  bool // the body yields
 }
 
 func (fl *FunctionLiteralExpression) expressionNode()      {}
 func (fl *FunctionLiteralExpression) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteralExpression) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FunctionLiteralExpression) End() token.Position  { return endOf(fl.Body, fl.Token) }
 func (fl *FunctionLiteralExpression) String() string {
 	var out bytes.Buffer
 
@@ -249,15 +529,62 @@ func (fl *FunctionLiteralExpression) String() string {
 	return out.String()
 }
 
+// Named function declaration
+type FunctionStatement struct {
+	Token    token.Token // the fn token
+	Name     *Identifier
+	Function *FunctionLiteralExpression
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() token.Position  { return fs.Token.Pos() }
+func (fs *FunctionStatement) End() token.Position  { return endOf(fs.Function, fs.Token) }
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+
+	for _, param := range fs.Function.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString(fs.TokenLiteral())
+	out.WriteString(" ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ","))
+	out.WriteString(")")
+	out.WriteString(fs.Function.Body.String())
+
+	return out.String()
+}
+
 // Function call
 type FunctionCallExpression struct {
 	Token      token.Token // the IF token
 	Function   Expression  // identifier or function literal
 	Parameters []Expression
+	Tail       bool        // the call is the last thing its function does
+	Rparen     token.Token // the ) token, unset for piped calls without parentheses
 }
 
 func (fc *FunctionCallExpression) expressionNode()      {}
 func (fc *FunctionCallExpression) TokenLiteral() string { return fc.Token.Literal }
+func (fc *FunctionCallExpression) Pos() token.Position {
+	// piped calls start with their first argument
+	pos := posOf(fc.Function, fc.Token)
+	if len(fc.Parameters) > 0 && fc.Parameters[0] != nil && fc.Parameters[0].Pos().Before(pos) {
+		return fc.Parameters[0].Pos()
+	}
+	return pos
+}
+func (fc *FunctionCallExpression) End() token.Position {
+	if !fc.Rparen.Pos().IsValid() {
+		return endOf(fc.Function, fc.Token)
+	}
+	return fc.Rparen.End()
+}
 func (fc *FunctionCallExpression) String() string {
 	var out bytes.Buffer
 
@@ -283,16 +610,21 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos() }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End() }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 // Array
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Token // the ] token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos() }
+func (al *ArrayLiteral) End() token.Position  { return al.Rbracket.End() }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -309,33 +641,116 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// ...array, spliced into call arguments and array literals
+type SpreadExpression struct {
+	Token token.Token // the ... token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SpreadExpression) End() token.Position  { return endOf(se.Value, se.Token) }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 // Index expression
 type IndexingExpression struct {
-	Token  token.Token
-	Index  Expression
-	Target Expression
+	Token    token.Token
+	Index    Expression
+	Target   Expression
+	Optional bool        // target?.[index], null when the target is null
+	Rbracket token.Token // the ] token
 }
 
 func (ie *IndexingExpression) expressionNode()      {}
 func (ie *IndexingExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexingExpression) Pos() token.Position  { return posOf(ie.Target, ie.Token) }
+func (ie *IndexingExpression) End() token.Position  { return ie.Rbracket.End() }
 func (ie *IndexingExpression) String() string {
+	if ie.Optional {
+		return fmt.Sprintf("%s?.[%s]", ie.Target.String(), ie.Index.String())
+	}
 	return fmt.Sprintf("%s[%s]", ie.Target.String(), ie.Index.String())
 }
 
+// arr[1:3], either bound may be left out
+type SliceExpression struct {
+	Token    token.Token // the [ token
+	Target   Expression
+	Start    Expression
+	Stop     Expression
+	Rbracket token.Token // the ] token
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return posOf(se.Target, se.Token) }
+func (se *SliceExpression) End() token.Position  { return se.Rbracket.End() }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(se.Target.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.Stop != nil {
+		out.WriteString(se.Stop.String())
+	}
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// person.name, sugar for person["name"]
+type AccessExpression struct {
+	Token    token.Token // the . or ?. token
+	Target   Expression
+	Key      *Identifier
+	Optional bool // target?.key, null when the target is null
+}
+
+func (ae *AccessExpression) expressionNode()      {}
+func (ae *AccessExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AccessExpression) Pos() token.Position  { return posOf(ae.Target, ae.Token) }
+func (ae *AccessExpression) End() token.Position  { return endOf(ae.Key, ae.Token) }
+func (ae *AccessExpression) String() string {
+	return fmt.Sprintf("%s%s%s", ae.Target.String(), ae.Token.Literal, ae.Key.String())
+}
+
 // Hash
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  []HashPair  // in source order
+	Rbrace token.Token // the } token
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// Get returns the value of the first pair whose key reads the same as key
+func (hl *HashLiteral) Get(key Expression) (Expression, bool) {
+	for _, pair := range hl.Pairs {
+		if pair.Key.String() == key.String() {
+			return pair.Value, true
+		}
+	}
+	return nil, false
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos() }
+func (hl *HashLiteral) End() token.Position  { return hl.Rbrace.End() }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, fmt.Sprintf(`%s: %s`, k.String(), v.String()))
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, fmt.Sprintf(`%s: %s`, pair.Key.String(), pair.Value.String()))
 	}
 
 	out.WriteString("{")
@@ -344,3 +759,19 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// children may be missing, e.g. after parse errors, in which case the node's
+// own token stands in for them
+func posOf(node Node, fallback token.Token) token.Position {
+	if node == nil || isNilNode(node) {
+		return fallback.Pos()
+	}
+	return node.Pos()
+}
+
+func endOf(node Node, fallback token.Token) token.Position {
+	if node == nil || isNilNode(node) {
+		return fallback.End()
+	}
+	return node.End()
+}
@@ -1,7 +1,9 @@
 package ast
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +30,119 @@ func TestString(t *testing.T) {
 		t.Errorf("Expected program to equal %q, got %q", expected, actual)
 	}
 }
+
+func TestInspect(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IF, Literal: "if"},
+				Expression: &IfExpression{
+					Token:     token.Token{Type: token.IF, Literal: "if"},
+					Condition: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+					Consequence: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{
+								Expression: &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	visited := []string{}
+	Inspect(program, func(n Node) bool {
+		if n != nil {
+			visited = append(visited, fmt.Sprintf("%T", n))
+		}
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.ExpressionStatement",
+		"*ast.IfExpression",
+		"*ast.Identifier",
+		"*ast.BlockStatement",
+		"*ast.ExpressionStatement",
+		"*ast.IntegerLiteral",
+	}
+	if strings.Join(visited, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected visit order. expected=%v got=%v", expected, visited)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	integer := func(value int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+	}
+
+	// let x = 1 + 2; if (y) { return x; 3 }
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("x"),
+				Value: &InfixExpression{Token: token.Token{Type: token.PLUS, Literal: "+"}, Left: integer(1), Operator: "+", Right: integer(2)},
+			},
+			&ExpressionStatement{
+				Expression: &IfExpression{
+					Condition: ident("y"),
+					Consequence: &BlockStatement{
+						Statements: []Statement{
+							&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: ident("x")},
+							&ExpressionStatement{Expression: integer(3)},
+						},
+					},
+				},
+			},
+		},
+	}
+	original := program.String()
+
+	rewritten := Rewrite(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *InfixExpression:
+			// fold constants
+			left, lok := node.Left.(*IntegerLiteral)
+			right, rok := node.Right.(*IntegerLiteral)
+			if lok && rok && node.Operator == "+" {
+				return integer(left.Value + right.Value)
+			}
+		case *Identifier:
+			if node.Value == "y" {
+				return &BooleanExpression{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+			}
+		case *ExpressionStatement:
+			// drop unused constants
+			if _, ok := node.Expression.(*IntegerLiteral); ok {
+				return nil
+			}
+		}
+		return node
+	})
+
+	expected := "let x = 3;if true return x;"
+	if rewritten.String() != expected {
+		t.Errorf("wrong rewritten program. expected=%q got=%q", expected, rewritten.String())
+	}
+	if program.String() != original {
+		t.Errorf("the original program changed. expected=%q got=%q", original, program.String())
+	}
+
+	defer func() {
+		if r := recover(); r != "ast.Rewrite: *ast.IntegerLiteral can't be replaced by *ast.BlockStatement" {
+			t.Errorf("expected a panic for a misfit replacement, got %v", r)
+		}
+	}()
+	Rewrite(program, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &BlockStatement{}
+		}
+		return node
+	})
+}
@@ -0,0 +1,71 @@
+package ast
+
+import "reflect"
+
+// Clone returns a deep copy of the tree rooted at node, sharing no nodes with it
+func Clone(node Node) Node {
+	return Rewrite(node, func(n Node) Node { return n })
+}
+
+// Equal reports whether two trees have the same structure: nodes of the same
+// types with the same values. Tokens, and so positions, aren't compared, so a
+// tree built by hand can equal a parsed one.
+func Equal(a, b Node) bool {
+	return equalValues(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func equalValues(a, b reflect.Value) bool {
+	// a missing child may be a nil interface or a typed nil pointer
+	if isNilValue(a) || isNilValue(b) {
+		return isNilValue(a) && isNilValue(b)
+	}
+	if a.Kind() == reflect.Interface {
+		return equalValues(a.Elem(), b)
+	}
+	if b.Kind() == reflect.Interface {
+		return equalValues(a, b.Elem())
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr:
+		return equalValues(a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		if a.Type() == tokenType {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValues(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a.Interface() == b.Interface()
+}
+
+func isNilValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestClone(t *testing.T) {
+	program := parse(t, `let f = fn(x) { if (x) { [x, {"a": x}][0] } else { -x } }; f(1);`)
+	clone := ast.Clone(program)
+
+	if !ast.Equal(program, clone) {
+		t.Fatalf("clone differs from the original. expected=%q got=%q", program.String(), clone.String())
+	}
+
+	original := map[ast.Node]bool{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		original[n] = true
+		return true
+	})
+	ast.Inspect(clone, func(n ast.Node) bool {
+		if n != nil && original[n] {
+			t.Errorf("clone shares a %T with the original", n)
+		}
+		return true
+	})
+
+	// changing the clone leaves the original alone
+	ast.Inspect(clone, func(n ast.Node) bool {
+		if literal, ok := n.(*ast.IntegerLiteral); ok {
+			literal.Value = 2
+		}
+		return true
+	})
+	if ast.Equal(program, clone) {
+		t.Errorf("expected the changed clone to differ from the original")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"1 + 2", "1   +\n2", true},
+		{"1 + 2", "2 + 1", false},
+		{"1 + 2", "1 - 2", false},
+		{"f(a, b)", "f(a, b,)", true},
+		{"f(a, b)", "f(a)", false},
+		{`{"a": 1, "b": 2}`, `{"b": 2, "a": 1}`, false},
+		{"if (x) { 1 }", "if (x) { 1 } else { 2 }", false},
+		{"let x;", "let x = 1;", false},
+		{"a.b", "a?.b", false},
+		{"1", "1.0", false},
+	}
+
+	for _, tt := range tests {
+		if equal := ast.Equal(parse(t, tt.a), parse(t, tt.b)); equal != tt.expected {
+			t.Errorf("Equal(%q, %q) = %t, expected %t", tt.a, tt.b, equal, tt.expected)
+		}
+	}
+
+	if !ast.Equal(nil, nil) {
+		t.Errorf("expected nil to equal nil")
+	}
+	if ast.Equal(parse(t, "1"), nil) {
+		t.Errorf("expected a program not to equal nil")
+	}
+}
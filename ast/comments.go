@@ -0,0 +1,86 @@
+package ast
+
+import "monkey/token"
+
+// Comment is a // or /* */ comment. Comments aren't part of the tree; parsers
+// collect them in Program.Comments, and a CommentMap ties them to statements.
+type Comment struct {
+	Token token.Token // the COMMENT token
+	Text  string      // including the delimiters
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Text }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos() }
+func (c *Comment) End() token.Position  { return c.Token.End() }
+
+// NodeComments are the comments that belong to a node
+type NodeComments struct {
+	Leading  []*Comment // on the lines before a statement
+	Trailing []*Comment // after a statement, on the line it ends on
+	Dangling []*Comment // after the last statement of a block or program
+}
+
+// CommentMap ties comments to the statements they describe, and the ones
+// at the end of a block or program to the block or program
+type CommentMap map[Node]NodeComments
+
+// NewCommentMap attaches the comments of a program to its statements. A
+// comment on the line a statement ends belongs to it, any other comment to
+// the statement that follows it in the same block.
+func NewCommentMap(program *Program) CommentMap {
+	m := CommentMap{}
+
+	// blocks are visited before the blocks nested in them
+	blocks := []*BlockStatement{}
+	Inspect(program, func(n Node) bool {
+		if block, ok := n.(*BlockStatement); ok {
+			blocks = append(blocks, block)
+		}
+		return true
+	})
+
+	for _, comment := range program.Comments {
+		var owner Node = program
+		statements := program.Statements
+		for _, block := range blocks {
+			if block.Token.Pos().Before(comment.Pos()) && comment.Pos().Before(block.Rbrace.Pos()) {
+				owner, statements = block, block.Statements
+			}
+		}
+		m.attach(owner, statements, comment)
+	}
+
+	return m
+}
+
+func (m CommentMap) attach(owner Node, statements []Statement, comment *Comment) {
+	pos := comment.Pos()
+	for i, stmt := range statements {
+		if !pos.Before(stmt.End()) {
+			continue
+		}
+
+		// the comment comes before the end of stmt
+		if i > 0 && statements[i-1].End().Line == pos.Line && pos.Before(stmt.Pos()) {
+			m.add(statements[i-1], func(c *NodeComments) *[]*Comment { return &c.Trailing }, comment)
+		} else if !pos.Before(stmt.Pos()) && stmt.End().Line == pos.Line {
+			m.add(stmt, func(c *NodeComments) *[]*Comment { return &c.Trailing }, comment)
+		} else {
+			m.add(stmt, func(c *NodeComments) *[]*Comment { return &c.Leading }, comment)
+		}
+		return
+	}
+
+	if len(statements) > 0 && statements[len(statements)-1].End().Line == pos.Line {
+		m.add(statements[len(statements)-1], func(c *NodeComments) *[]*Comment { return &c.Trailing }, comment)
+		return
+	}
+	m.add(owner, func(c *NodeComments) *[]*Comment { return &c.Dangling }, comment)
+}
+
+func (m CommentMap) add(node Node, list func(*NodeComments) *[]*Comment, comment *Comment) {
+	comments := m[node]
+	*list(&comments) = append(*list(&comments), comment)
+	m[node] = comments
+}
@@ -0,0 +1,65 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestNewCommentMap(t *testing.T) {
+	input := `// about x
+let x = 1; // one
+let f = fn() {
+	// inside
+	x;
+	/* last */
+};
+let h = {
+	// key
+	"a": 1,
+};
+// the end`
+	p := parser.New(lexer.New(input, lexer.WithComments()))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comments := ast.NewCommentMap(program)
+
+	texts := func(list []*ast.Comment) []string {
+		result := []string{}
+		for _, comment := range list {
+			result = append(result, comment.Text)
+		}
+		return result
+	}
+	body := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteralExpression).Body
+
+	tests := []struct {
+		name     string
+		got      []*ast.Comment
+		expected []string
+	}{
+		{"x leading", comments[program.Statements[0]].Leading, []string{"// about x"}},
+		{"x trailing", comments[program.Statements[0]].Trailing, []string{"// one"}},
+		{"f leading", comments[program.Statements[1]].Leading, []string{}},
+		{"body statement", comments[body.Statements[0]].Leading, []string{"// inside"}},
+		{"body dangling", comments[body].Dangling, []string{"/* last */"}},
+		{"h leading", comments[program.Statements[2]].Leading, []string{"// key"}},
+		{"program dangling", comments[program].Dangling, []string{"// the end"}},
+	}
+
+	for _, tt := range tests {
+		got := texts(tt.got)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+	"unicode"
+)
+
+// every node type, by the kind it's tagged with in JSON
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &Comment{}, &LetStatement{}, &ArrayPattern{}, &HashPattern{}, &EnumStatement{},
+		&ReturnStatement{}, &ThrowStatement{}, &ExpressionStatement{}, &BlockStatement{},
+		&BreakStatement{}, &ContinueStatement{}, &FunctionStatement{},
+		&Identifier{}, &IntegerLiteral{}, &FloatLiteral{}, &BooleanExpression{}, &StringLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &AssignExpression{}, &IfExpression{},
+		&WhileExpression{}, &TryExpression{}, &DelayExpression{}, &YieldExpression{},
+		&SpawnExpression{}, &FunctionLiteralExpression{}, &FunctionCallExpression{},
+		&ArrayLiteral{}, &SpreadExpression{}, &IndexingExpression{}, &SliceExpression{},
+		&AccessExpression{}, &HashLiteral{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeKinds[t.Name()] = t
+	}
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// MarshalJSON encodes a tree as JSON. Every node is an object whose "kind" is
+// the name of its type, e.g. "InfixExpression", alongside its fields.
+func MarshalJSON(node Node) ([]byte, error) {
+	encoded, err := encodeValue(reflect.ValueOf(&node).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON
+func UnmarshalJSON(data []byte) (Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keeps integer literals exact
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	var node Node
+	if err := decodeValue(reflect.ValueOf(&node).Elem(), decoded); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeValue(v.Elem())
+		}
+		return encodeNode(v)
+
+	case reflect.Struct:
+		if v.Type() != tokenType {
+			return encodeFields(v)
+		}
+		tok := v.Interface().(token.Token)
+		encoded := map[string]interface{}{
+			"type":    tok.Type,
+			"literal": tok.Literal,
+			"line":    tok.Line,
+			"column":  tok.Column,
+		}
+		if tok.File != "" {
+			encoded["file"] = tok.File
+		}
+		return encoded, nil
+
+	case reflect.Slice:
+		list := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			el, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, el)
+		}
+		return list, nil
+
+	case reflect.String, reflect.Bool, reflect.Int64, reflect.Float64:
+		return v.Interface(), nil
+	}
+
+	return nil, fmt.Errorf("can't encode %s", v.Type())
+}
+
+func encodeNode(v reflect.Value) (interface{}, error) {
+	t := v.Elem().Type()
+	if _, ok := nodeKinds[t.Name()]; !ok {
+		return nil, fmt.Errorf("can't encode %s", v.Type())
+	}
+
+	encoded, err := encodeFields(v.Elem())
+	if err != nil {
+		return nil, err
+	}
+	encoded["kind"] = t.Name()
+	return encoded, nil
+}
+
+// structs that aren't nodes, like the pairs of a hash literal, are encoded
+// like nodes without a kind
+func encodeFields(v reflect.Value) (map[string]interface{}, error) {
+	encoded := map[string]interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		field, err := encodeValue(v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		encoded[fieldName(v.Type().Field(i))] = field
+	}
+	return encoded, nil
+}
+
+// fields are named in lower camel case, e.g. ReturnValue is "returnValue"
+func fieldName(field reflect.StructField) string {
+	name := []rune(field.Name)
+	name[0] = unicode.ToLower(name[0])
+	return string(name)
+}
+
+func decodeValue(v reflect.Value, data interface{}) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if data == nil {
+			return nil
+		}
+		node, err := decodeNode(data)
+		if err != nil {
+			return err
+		}
+		if !reflect.TypeOf(node).AssignableTo(v.Type()) {
+			return fmt.Errorf("%T can't be used as %s", node, v.Type())
+		}
+		v.Set(reflect.ValueOf(node))
+		return nil
+
+	case reflect.Struct:
+		encoded, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("can't decode %s from %v", v.Type(), data)
+		}
+		if v.Type() != tokenType {
+			return decodeFields(v, encoded)
+		}
+		tok := token.Token{}
+		tok.Type = token.TokenType(stringField(encoded, "type"))
+		tok.Literal = stringField(encoded, "literal")
+		tok.File = stringField(encoded, "file")
+		tok.Line = intField(encoded, "line")
+		tok.Column = intField(encoded, "column")
+		v.Set(reflect.ValueOf(tok))
+		return nil
+
+	case reflect.Slice:
+		list, ok := data.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list for %s, got %v", v.Type(), data)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, el := range list {
+			if err := decodeValue(slice.Index(i), el); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", data)
+		}
+		v.SetString(s)
+		return nil
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", data)
+		}
+		v.SetBool(b)
+		return nil
+
+	case reflect.Int64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %v", data)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+
+	case reflect.Float64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected a number, got %v", data)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	return fmt.Errorf("can't decode %s", v.Type())
+}
+
+func decodeNode(data interface{}) (Node, error) {
+	encoded, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a node, got %v", data)
+	}
+	kind, _ := encoded["kind"].(string)
+	t, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	node := reflect.New(t)
+	if err := decodeFields(node.Elem(), encoded); err != nil {
+		return nil, fmt.Errorf("%s.%w", kind, err)
+	}
+	return node.Interface().(Node), nil
+}
+
+func decodeFields(v reflect.Value, encoded map[string]interface{}) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, ok := encoded[fieldName(v.Type().Field(i))]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(v.Field(i), field); err != nil {
+			return fmt.Errorf("%s: %w", v.Type().Field(i).Name, err)
+		}
+	}
+	return nil
+}
+
+func stringField(encoded map[string]interface{}, name string) string {
+	s, _ := encoded[name].(string)
+	return s
+}
+
+func intField(encoded map[string]interface{}, name string) int {
+	n, _ := encoded[name].(json.Number)
+	i, _ := n.Int64()
+	return int(i)
+}
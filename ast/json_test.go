@@ -0,0 +1,92 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+let [a, b] = [1, 2.5];
+let {c} = {"c": true, 1: "one", c: false, [1][0]: 2};
+enum Color { Red, Green }
+fn add(x, y) { return x + y; }
+let f = fn(n) {
+	if (!n) { throw "no" } else { n }
+	while (n > 0) { n -= 1; if (n == 3) { break; } continue; }
+	yield n;
+};
+let g = delay(add(1, 2));
+try { spawn f(1) } catch (e) { e.message }
+let h = a?.b?.[0] |> len;
+let s = [...b][1:];
+let x;
+`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON failed: %s", err)
+	}
+
+	if node.String() != program.String() {
+		t.Errorf("round trip changed the program. expected=%q got=%q", program.String(), node.String())
+	}
+	again, err := ast.MarshalJSON(node)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("round trip changed the JSON.\nexpected=%s\ngot=%s", data, again)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	exp, errs := parser.ParseExpressionString("-x")
+	if len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+
+	data, err := ast.MarshalJSON(exp)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+
+	expected := `{"kind":"PrefixExpression","operator":"-",` +
+		`"right":{"kind":"Identifier","token":{"column":2,"line":1,"literal":"x","type":"IDENT"},"value":"x"},` +
+		`"token":{"column":1,"line":1,"literal":"-","type":"-"}}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `unknown node kind "Nope"`},
+		{`{"kind":"ExpressionStatement","expression":{"kind":"BreakStatement"}}`, "ExpressionStatement.Expression: *ast.BreakStatement can't be used as ast.Expression"},
+		{`{"kind":"IntegerLiteral","value":"1"}`, "IntegerLiteral.Value: expected an integer, got 1"},
+		{`[1]`, "expected a node, got [1]"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.UnmarshalJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. expected=%q got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package ast
+
+import "fmt"
+
+// Rewrite rebuilds the tree rooted at node from the bottom up: the children of
+// a node are rewritten first, then fn is called with a copy of the node holding
+// the rewritten children, and its result takes the node's place. The original
+// tree is left untouched.
+//
+// fn returns its argument to keep a node. Returning nil removes the node from
+// the list it's in, or leaves the field it's in empty. A replacement must fit
+// where the node was, e.g. an expression can't be replaced by a statement;
+// Rewrite panics if it doesn't.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	if node == nil || isNilNode(node) {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Statements = rewriteStatements(n.Statements, fn)
+		if n.Comments != nil {
+			c.Comments = []*Comment{}
+			for _, comment := range n.Comments {
+				if comment := Rewrite(comment, fn); !removed(comment) {
+					c.Comments = append(c.Comments, comment.(*Comment))
+				}
+			}
+		}
+		return fn(&c)
+
+	case *LetStatement:
+		c := *n
+		c.Name = rewriteIdentifier(n.Name, fn)
+		if n.Pattern != nil {
+			c.Pattern = rewritePattern(n.Pattern, fn)
+		}
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *ArrayPattern:
+		c := *n
+		c.Elements = rewriteIdentifiers(n.Elements, fn)
+		return fn(&c)
+
+	case *HashPattern:
+		c := *n
+		c.Keys = rewriteIdentifiers(n.Keys, fn)
+		return fn(&c)
+
+	case *EnumStatement:
+		c := *n
+		c.Name = rewriteIdentifier(n.Name, fn)
+		c.Variants = rewriteIdentifiers(n.Variants, fn)
+		return fn(&c)
+
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = rewriteExpression(n.ReturnValue, fn)
+		return fn(&c)
+
+	case *ThrowStatement:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = rewriteExpression(n.Expression, fn)
+		return fn(&c)
+
+	case *BlockStatement:
+		c := *n
+		c.Statements = rewriteStatements(n.Statements, fn)
+		return fn(&c)
+
+	case *PrefixExpression:
+		c := *n
+		c.Right = rewriteExpression(n.Right, fn)
+		return fn(&c)
+
+	case *InfixExpression:
+		c := *n
+		c.Left = rewriteExpression(n.Left, fn)
+		c.Right = rewriteExpression(n.Right, fn)
+		return fn(&c)
+
+	case *AssignExpression:
+		c := *n
+		c.Name = rewriteIdentifier(n.Name, fn)
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *IfExpression:
+		c := *n
+		c.Condition = rewriteExpression(n.Condition, fn)
+		c.Consequence = rewriteBlock(n.Consequence, fn)
+		c.Alternative = rewriteBlock(n.Alternative, fn)
+		return fn(&c)
+
+	case *WhileExpression:
+		c := *n
+		c.Condition = rewriteExpression(n.Condition, fn)
+		c.Body = rewriteBlock(n.Body, fn)
+		return fn(&c)
+
+	case *TryExpression:
+		c := *n
+		c.Body = rewriteBlock(n.Body, fn)
+		c.Param = rewriteIdentifier(n.Param, fn)
+		c.Handler = rewriteBlock(n.Handler, fn)
+		return fn(&c)
+
+	case *DelayExpression:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *YieldExpression:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *SpawnExpression:
+		c := *n
+		c.Call = nil
+		if call := Rewrite(n.Call, fn); call != nil && !isNilNode(call) {
+			var ok bool
+			if c.Call, ok = call.(*FunctionCallExpression); !ok {
+				panic(misfit(n.Call, call))
+			}
+		}
+		return fn(&c)
+
+	case *FunctionStatement:
+		c := *n
+		c.Name = rewriteIdentifier(n.Name, fn)
+		c.Function = nil
+		if function := Rewrite(n.Function, fn); function != nil && !isNilNode(function) {
+			var ok bool
+			if c.Function, ok = function.(*FunctionLiteralExpression); !ok {
+				panic(misfit(n.Function, function))
+			}
+		}
+		return fn(&c)
+
+	case *FunctionLiteralExpression:
+		c := *n
+		c.Parameters = rewriteIdentifiers(n.Parameters, fn)
+		c.Body = rewriteBlock(n.Body, fn)
+		return fn(&c)
+
+	case *FunctionCallExpression:
+		c := *n
+		c.Function = rewriteExpression(n.Function, fn)
+		c.Parameters = rewriteExpressions(n.Parameters, fn)
+		return fn(&c)
+
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = rewriteExpressions(n.Elements, fn)
+		return fn(&c)
+
+	case *SpreadExpression:
+		c := *n
+		c.Value = rewriteExpression(n.Value, fn)
+		return fn(&c)
+
+	case *IndexingExpression:
+		c := *n
+		c.Target = rewriteExpression(n.Target, fn)
+		c.Index = rewriteExpression(n.Index, fn)
+		return fn(&c)
+
+	case *SliceExpression:
+		c := *n
+		c.Target = rewriteExpression(n.Target, fn)
+		c.Start = rewriteExpression(n.Start, fn)
+		c.Stop = rewriteExpression(n.Stop, fn)
+		return fn(&c)
+
+	case *AccessExpression:
+		c := *n
+		c.Target = rewriteExpression(n.Target, fn)
+		c.Key = rewriteIdentifier(n.Key, fn)
+		return fn(&c)
+
+	case *HashLiteral:
+		c := *n
+		c.Pairs = []HashPair{}
+		for _, pair := range n.Pairs {
+			key, value := rewriteExpression(pair.Key, fn), rewriteExpression(pair.Value, fn)
+			// a pair is removed along with its key or value
+			if key != nil && value != nil {
+				c.Pairs = append(c.Pairs, HashPair{Key: key, Value: value})
+			}
+		}
+		return fn(&c)
+
+	case *Comment:
+		c := *n
+		return fn(&c)
+	case *Identifier:
+		c := *n
+		return fn(&c)
+	case *IntegerLiteral:
+		c := *n
+		return fn(&c)
+	case *FloatLiteral:
+		c := *n
+		return fn(&c)
+	case *BooleanExpression:
+		c := *n
+		return fn(&c)
+	case *StringLiteral:
+		c := *n
+		return fn(&c)
+	case *BreakStatement:
+		c := *n
+		return fn(&c)
+	case *ContinueStatement:
+		c := *n
+		return fn(&c)
+	}
+
+	panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", node))
+}
+
+func misfit(node Node, replacement Node) string {
+	return fmt.Sprintf("ast.Rewrite: %T can't be replaced by %T", node, replacement)
+}
+
+// a removed node reads as nil, whatever its type
+func removed(node Node) bool {
+	return node == nil || isNilNode(node)
+}
+
+func rewriteExpression(exp Expression, fn func(Node) Node) Expression {
+	if exp == nil {
+		return nil
+	}
+	rewritten := Rewrite(exp, fn)
+	if removed(rewritten) {
+		return nil
+	}
+	replacement, ok := rewritten.(Expression)
+	if !ok {
+		panic(misfit(exp, rewritten))
+	}
+	return replacement
+}
+
+func rewriteExpressions(list []Expression, fn func(Node) Node) []Expression {
+	if list == nil {
+		return nil
+	}
+	rewritten := []Expression{}
+	for _, exp := range list {
+		if exp := rewriteExpression(exp, fn); exp != nil {
+			rewritten = append(rewritten, exp)
+		}
+	}
+	return rewritten
+}
+
+func rewriteStatements(list []Statement, fn func(Node) Node) []Statement {
+	if list == nil {
+		return nil
+	}
+	rewritten := []Statement{}
+	for _, stmt := range list {
+		node := Rewrite(stmt, fn)
+		if removed(node) {
+			continue
+		}
+		replacement, ok := node.(Statement)
+		if !ok {
+			panic(misfit(stmt, node))
+		}
+		rewritten = append(rewritten, replacement)
+	}
+	return rewritten
+}
+
+func rewriteIdentifier(ident *Identifier, fn func(Node) Node) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	rewritten := Rewrite(ident, fn)
+	if removed(rewritten) {
+		return nil
+	}
+	replacement, ok := rewritten.(*Identifier)
+	if !ok {
+		panic(misfit(ident, rewritten))
+	}
+	return replacement
+}
+
+func rewriteIdentifiers(list []*Identifier, fn func(Node) Node) []*Identifier {
+	if list == nil {
+		return nil
+	}
+	rewritten := []*Identifier{}
+	for _, ident := range list {
+		if ident := rewriteIdentifier(ident, fn); ident != nil {
+			rewritten = append(rewritten, ident)
+		}
+	}
+	return rewritten
+}
+
+func rewriteBlock(block *BlockStatement, fn func(Node) Node) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	rewritten := Rewrite(block, fn)
+	if removed(rewritten) {
+		return nil
+	}
+	replacement, ok := rewritten.(*BlockStatement)
+	if !ok {
+		panic(misfit(block, rewritten))
+	}
+	return replacement
+}
+
+func rewritePattern(pattern Pattern, fn func(Node) Node) Pattern {
+	rewritten := Rewrite(pattern, fn)
+	if removed(rewritten) {
+		return nil
+	}
+	replacement, ok := rewritten.(Pattern)
+	if !ok {
+		panic(misfit(pattern, rewritten))
+	}
+	return replacement
+}
@@ -0,0 +1,169 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sexpr renders a tree as compact s-expressions, e.g. `let x = 1 + 2;` is
+// (let x (+ 1 2)). Unlike String(), every node is delimited, so the structure
+// of the tree is easy to read off. The statements of a program go on separate lines.
+func Sexpr(node Node) string {
+	if node == nil || isNilNode(node) {
+		return "_"
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		statements := []string{}
+		for _, stmt := range n.Statements {
+			statements = append(statements, Sexpr(stmt))
+		}
+		return strings.Join(statements, "\n")
+
+	case *LetStatement:
+		target := Sexpr(n.Name)
+		if n.Pattern != nil {
+			target = Sexpr(n.Pattern)
+		}
+		if n.Value == nil {
+			return list("let", target)
+		}
+		return list("let", target, Sexpr(n.Value))
+
+	case *ArrayPattern:
+		return "[" + strings.Join(identifiers(n.Elements), " ") + "]"
+
+	case *HashPattern:
+		return "{" + strings.Join(identifiers(n.Keys), " ") + "}"
+
+	case *EnumStatement:
+		return list(append([]string{"enum", Sexpr(n.Name)}, identifiers(n.Variants)...)...)
+
+	case *ReturnStatement:
+		return list("return", Sexpr(n.ReturnValue))
+
+	case *ThrowStatement:
+		return list("throw", Sexpr(n.Value))
+
+	case *ExpressionStatement:
+		return Sexpr(n.Expression)
+
+	case *BlockStatement:
+		parts := []string{"block"}
+		for _, stmt := range n.Statements {
+			parts = append(parts, Sexpr(stmt))
+		}
+		return list(parts...)
+
+	case *BreakStatement:
+		return "(break)"
+
+	case *ContinueStatement:
+		return "(continue)"
+
+	case *Identifier:
+		return n.Value
+
+	case *IntegerLiteral:
+		return n.Token.Literal
+
+	case *FloatLiteral:
+		return n.Token.Literal
+
+	case *BooleanExpression:
+		return fmt.Sprintf("%t", n.Value)
+
+	case *StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+
+	case *PrefixExpression:
+		return list(n.Operator, Sexpr(n.Right))
+
+	case *InfixExpression:
+		return list(n.Operator, Sexpr(n.Left), Sexpr(n.Right))
+
+	case *AssignExpression:
+		return list("=", Sexpr(n.Name), Sexpr(n.Value))
+
+	case *IfExpression:
+		if n.Alternative == nil {
+			return list("if", Sexpr(n.Condition), Sexpr(n.Consequence))
+		}
+		return list("if", Sexpr(n.Condition), Sexpr(n.Consequence), Sexpr(n.Alternative))
+
+	case *WhileExpression:
+		return list("while", Sexpr(n.Condition), Sexpr(n.Body))
+
+	case *TryExpression:
+		return list("try", Sexpr(n.Body), Sexpr(n.Param), Sexpr(n.Handler))
+
+	case *DelayExpression:
+		return list("delay", Sexpr(n.Value))
+
+	case *YieldExpression:
+		return list("yield", Sexpr(n.Value))
+
+	case *SpawnExpression:
+		return list("spawn", Sexpr(n.Call))
+
+	case *FunctionStatement:
+		return list("fn", Sexpr(n.Name), list(identifiers(n.Function.Parameters)...), Sexpr(n.Function.Body))
+
+	case *FunctionLiteralExpression:
+		return list("fn", list(identifiers(n.Parameters)...), Sexpr(n.Body))
+
+	case *FunctionCallExpression:
+		parts := []string{"call", Sexpr(n.Function)}
+		for _, param := range n.Parameters {
+			parts = append(parts, Sexpr(param))
+		}
+		return list(parts...)
+
+	case *ArrayLiteral:
+		parts := []string{"array"}
+		for _, el := range n.Elements {
+			parts = append(parts, Sexpr(el))
+		}
+		return list(parts...)
+
+	case *SpreadExpression:
+		return list("...", Sexpr(n.Value))
+
+	case *IndexingExpression:
+		if n.Optional {
+			return list("?index", Sexpr(n.Target), Sexpr(n.Index))
+		}
+		return list("index", Sexpr(n.Target), Sexpr(n.Index))
+
+	case *SliceExpression:
+		return list("slice", Sexpr(n.Target), Sexpr(n.Start), Sexpr(n.Stop))
+
+	case *AccessExpression:
+		if n.Optional {
+			return list("?.", Sexpr(n.Target), Sexpr(n.Key))
+		}
+		return list(".", Sexpr(n.Target), Sexpr(n.Key))
+
+	case *HashLiteral:
+		parts := []string{"hash"}
+		for _, pair := range n.Pairs {
+			parts = append(parts, list(Sexpr(pair.Key), Sexpr(pair.Value)))
+		}
+		return list(parts...)
+	}
+
+	return fmt.Sprintf("(? %T)", node)
+}
+
+func list(parts ...string) string {
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func identifiers(idents []*Identifier) []string {
+	names := []string{}
+	for _, ident := range idents {
+		names = append(names, ident.Value)
+	}
+	return names
+}
@@ -0,0 +1,47 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSexpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2 * 3;", "(let x (+ 1 (* 2 3)))"},
+		{"let x;", "(let x)"},
+		{"let [a, b] = c;", "(let [a b] c)"},
+		{"let {a} = c;", "(let {a} c)"},
+		{"enum Color { Red, Green }", "(enum Color Red Green)"},
+		{"-a; !b", "(- a)\n(! b)"},
+		{`add(1, "two", 3.5, true)`, `(call add 1 "two" 3.5 true)`},
+		{"fn add(x, y) { return x + y; }", "(fn add (x y) (block (return (+ x y))))"},
+		{"fn() { 1 }", "(fn () (block 1))"},
+		{"if (x) { 1 } else { 2 }", "(if x (block 1) (block 2))"},
+		{"if (x) { 1 }", "(if x (block 1))"},
+		{"while (x) { x -= 1; break; continue }", "(while x (block (= x (- x 1)) (break) (continue)))"},
+		{"try { throw 1 } catch (e) { e }", "(try (block (throw 1)) e (block e))"},
+		{"delay(1); yield 2; spawn f()", "(delay 1)\n(yield 2)\n(spawn (call f))"},
+		{"[1, ...a][0]", "(index (array 1 (... a)) 0)"},
+		{"a[1:]; a?.[0]", "(slice a 1 _)\n(?index a 0)"},
+		{"a.b?.c", "(?. (. a b) c)"},
+		{`{"a": 1, 2: b}`, `(hash ("a" 1) (2 b))`},
+		{"x |> f", "(call f x)"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		if sexpr := ast.Sexpr(program); sexpr != tt.expected {
+			t.Errorf("wrong s-expression for %q. expected=%q got=%q", tt.input, tt.expected, sexpr)
+		}
+	}
+}
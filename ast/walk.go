@@ -0,0 +1,168 @@
+package ast
+
+import "reflect"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, mirroring go/ast.Walk
+func Walk(v Visitor, node Node) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		}
+		Walk(v, n.Value)
+
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			Walk(v, el)
+		}
+
+	case *HashPattern:
+		for _, key := range n.Keys {
+			Walk(v, key)
+		}
+
+	case *EnumStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+
+	case *ThrowStatement:
+		Walk(v, n.Value)
+
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *AssignExpression:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+
+	case *WhileExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Body)
+
+	case *TryExpression:
+		Walk(v, n.Body)
+		Walk(v, n.Param)
+		Walk(v, n.Handler)
+
+	case *DelayExpression:
+		Walk(v, n.Value)
+
+	case *YieldExpression:
+		Walk(v, n.Value)
+
+	case *SpawnExpression:
+		Walk(v, n.Call)
+
+	case *FunctionStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+
+	case *FunctionLiteralExpression:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+
+	case *FunctionCallExpression:
+		Walk(v, n.Function)
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			Walk(v, el)
+		}
+
+	case *SpreadExpression:
+		Walk(v, n.Value)
+
+	case *IndexingExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Index)
+
+	case *SliceExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Start)
+		Walk(v, n.Stop)
+
+	case *AccessExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Key)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			Walk(v, pair.Key)
+			Walk(v, pair.Value)
+		}
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *BooleanExpression, *StringLiteral,
+		*BreakStatement, *ContinueStatement:
+		// leaves
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f for each node.
+// Children are skipped if f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// typed nil pointers (e.g. a missing else block) must not be visited
+func isNilNode(node Node) bool {
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
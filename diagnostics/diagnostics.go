@@ -0,0 +1,46 @@
+// Package diagnostics renders errors together with the source they point at
+package diagnostics
+
+import (
+	"monkey/token"
+	"strings"
+)
+
+// Render follows the message with the line of source the position points at
+// and a caret under the column. Positions outside of the source, e.g. unknown
+// ones, leave the message as it is.
+func Render(source string, pos token.Position, message string) string {
+	excerpt, ok := Excerpt(source, pos)
+	if !ok {
+		return message
+	}
+	return message + "\n" + excerpt
+}
+
+// Excerpt returns the line of source the position points at, with a caret
+// under the column on the line below it
+func Excerpt(source string, pos token.Position) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return "", false
+	}
+
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+	if pos.Column < 1 || pos.Column > len(line)+1 {
+		return "", false
+	}
+
+	// columns count bytes, the caret has to line up with the characters
+	// before it, tabs included
+	var caret strings.Builder
+	for _, ch := range line[:pos.Column-1] {
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return "  " + line + "\n  " + caret.String(), true
+}
@@ -0,0 +1,29 @@
+package diagnostics
+
+import (
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tlet café = x + true;\r\nputs(x)"
+
+	tests := []struct {
+		pos      token.Position
+		expected string
+	}{
+		{token.Position{Line: 1, Column: 5}, "oops\n  let x = 1;\n      ^"},
+		{token.Position{Line: 2, Column: 18}, "oops\n  \tlet café = x + true;\n  \t" + strings.Repeat(" ", 15) + "^"},
+		{token.Position{Line: 3, Column: 8}, "oops\n  puts(x)\n         ^"},
+		{token.Position{Line: 3, Column: 9}, "oops"},
+		{token.Position{Line: 4, Column: 1}, "oops"},
+		{token.Position{}, "oops"},
+	}
+
+	for _, tt := range tests {
+		if rendered := Render(source, tt.pos, "oops"); rendered != tt.expected {
+			t.Errorf("wrong rendering at %s. expected=%q got=%q", tt.pos, tt.expected, rendered)
+		}
+	}
+}
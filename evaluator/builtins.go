@@ -1,42 +1,73 @@
 package evaluator
 
-import "monkey/object"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"monkey/object"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
 
 var builtins = map[string]*object.Builtin{
 	"push": {
+		Doc: "push(array, values...): returns a new array with the values appended; the array itself doesn't change, and can't be frozen",
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. expected=2 got=%d", len(args))
+			if len(args) < 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected at least 1 got=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.Array:
-				return &object.Array{Elements: append(arg.Elements, args[1])}
+				if err := refuseFrozen("push", arg); err != nil {
+					return err
+				}
+				return arg.Append(args[1:]...)
 			default:
-				return newError("argument to `push` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `push` not supported, got %s", args[0].Type())
 			}
 		},
+		// the array shares its storage with the one it's pushed to
+		Allocated: func(args []object.Object, result object.Object) int {
+			return elementSize * (len(args) - 1)
+		},
 	},
 	"len": {
+		Doc: "len(value): returns the number of characters in a string, bytes in a byte array or elements in an array or set",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. expected=1 got=%d", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				return object.NewInteger(int64(utf8.RuneCountInString(arg.Value)))
 			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
+				return object.NewInteger(int64(len(arg.Elements)))
+			case *object.Bytes:
+				return object.NewInteger(int64(len(arg.Value)))
+			case *object.Set:
+				return object.NewInteger(int64(arg.Len()))
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
 	"first": {
+		Doc: "first(array): returns the first element of an array, or null if empty",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. expected=1 got=%d", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -46,14 +77,16 @@ var builtins = map[string]*object.Builtin{
 				}
 				return arg.Elements[0]
 			default:
-				return newError("argument to `first` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `first` not supported, got %s", args[0].Type())
 			}
 		},
+		Allocated: allocatesNothing,
 	},
 	"last": {
+		Doc: "last(array): returns the last element of an array, or null if empty",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. expected=1 got=%d", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -63,14 +96,16 @@ var builtins = map[string]*object.Builtin{
 				}
 				return arg.Elements[len(arg.Elements)-1]
 			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `last` not supported, got %s", args[0].Type())
 			}
 		},
+		Allocated: allocatesNothing,
 	},
 	"rest": {
+		Doc: "rest(array): returns a new array without the first element",
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. expected=1 got=%d", len(args))
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
 			}
 
 			switch arg := args[0].(type) {
@@ -80,8 +115,1719 @@ var builtins = map[string]*object.Builtin{
 				}
 				return &object.Array{Elements: arg.Elements[1:]}
 			default:
-				return newError("argument to `rest` not supported, got %s", args[0].Type())
+				return newError(object.TYPE_ERROR, "argument to `rest` not supported, got %s", args[0].Type())
+			}
+		},
+		Allocated: allocatesNothing,
+	},
+	"freeze": {
+		Doc: "freeze(value): marks an array or hash, and the arrays and hashes inside it, as immutable and returns it; push, put, delete and merge refuse frozen values",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch args[0].(type) {
+			case *object.Array, *object.Hash:
+				freeze(args[0])
+				return args[0]
+			default:
+				return newError(object.TYPE_ERROR, "argument to `freeze` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"is_frozen": {
+		Doc: "is_frozen(value): reports whether a value is immutable; only unfrozen arrays and hashes aren't",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return nativeBoolToBooleanObject(arg.Frozen())
+			case *object.Hash:
+				return nativeBoolToBooleanObject(arg.Frozen())
+			default:
+				return TRUE
+			}
+		},
+	},
+	"eq": {
+		Doc: "eq(a, b): reports whether two values are equal, comparing arrays, hashes and sets by their contents",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+			}
+			return nativeBoolToBooleanObject(objectsEqual(args[0], args[1]))
+		},
+	},
+	"reverse": {
+		Doc: "reverse(array): returns a new array with the elements in reverse order",
+		Fn: func(args ...object.Object) object.Object {
+			array, err := arrayArgument("reverse", args, 1)
+			if err != nil {
+				return err
+			}
+
+			elements := make([]object.Object, len(array.Elements))
+			for i, el := range array.Elements {
+				elements[len(elements)-1-i] = el
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"concat": {
+		Doc: "concat(arrays...): returns a new array of the elements of all the arrays",
+		Fn: func(args ...object.Object) object.Object {
+			elements := []object.Object{}
+			for _, arg := range args {
+				array, ok := arg.(*object.Array)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `concat` not supported, got %s", arg.Type())
+				}
+				elements = append(elements, array.Elements...)
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"slice": {
+		Doc: "slice(array, start, end): returns a new array of the elements from start up to (not including) the optional end; bounds are clamped to the array",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 or 3 got=%d", len(args))
+			}
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `slice` not supported, got %s", args[0].Type())
+			}
+
+			bounds := []int64{0, int64(len(array.Elements))}
+			for i, arg := range args[1:] {
+				bound, ok := arg.(*object.Integer)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `slice` must be an INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = max(0, min(bound.Value, int64(len(array.Elements))))
+			}
+
+			start, end := bounds[0], max(bounds[0], bounds[1])
+			elements := make([]object.Object, end-start)
+			copy(elements, array.Elements[start:end])
+			return &object.Array{Elements: elements}
+		},
+	},
+	"flatten": {
+		Doc: "flatten(array): returns a new array with the elements of nested arrays spliced in, one level deep",
+		Fn: func(args ...object.Object) object.Object {
+			array, err := arrayArgument("flatten", args, 1)
+			if err != nil {
+				return err
+			}
+
+			elements := []object.Object{}
+			for _, el := range array.Elements {
+				if nested, ok := el.(*object.Array); ok {
+					elements = append(elements, nested.Elements...)
+				} else {
+					elements = append(elements, el)
+				}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"zip": {
+		Doc: "zip(a, b): returns an array of [a[i], b[i]] pairs, as long as the shorter array",
+		Fn: func(args ...object.Object) object.Object {
+			a, err := arrayArgument("zip", args, 2)
+			if err != nil {
+				return err
+			}
+			b, ok := args[1].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `zip` not supported, got %s", args[1].Type())
+			}
+
+			pairs := []object.Object{}
+			for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+				pairs = append(pairs, &object.Array{Elements: []object.Object{a.Elements[i], b.Elements[i]}})
+			}
+			return &object.Array{Elements: pairs}
+		},
+	},
+	"split": {
+		Doc: "split(string, separator): returns an array of the parts of the string between each separator",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("split", args, 2)
+			if err != nil {
+				return err
+			}
+
+			parts := []object.Object{}
+			for _, part := range strings.Split(strs[0], strs[1]) {
+				parts = append(parts, &object.String{Value: part})
+			}
+			return &object.Array{Elements: parts}
+		},
+	},
+	"join": {
+		Doc: "join(array, separator): returns the strings of an array joined by the separator",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+			}
+
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `join` not supported, got %s", args[0].Type())
+			}
+			separator, ok := args[1].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `join` must be a STRING, got %s", args[1].Type())
+			}
+
+			parts := []string{}
+			for _, el := range array.Elements {
+				part, ok := el.(*object.String)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `join` must only contain strings, got %s", el.Type())
+				}
+				parts = append(parts, part.Value)
+			}
+			return &object.String{Value: strings.Join(parts, separator.Value)}
+		},
+	},
+	"format": {
+		Doc: "format(template, values...): replaces each {} in the template with the next value; {{ and }} are literal braces",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected at least 1 got=%d", len(args))
+			}
+			template, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `format` not supported, got %s", args[0].Type())
+			}
+			values := args[1:]
+
+			var out strings.Builder
+			used := 0
+			for i := 0; i < len(template.Value); i++ {
+				rest := template.Value[i:]
+				switch {
+				case strings.HasPrefix(rest, "{{"), strings.HasPrefix(rest, "}}"):
+					out.WriteByte(rest[0])
+					i++
+				case strings.HasPrefix(rest, "{}"):
+					if used == len(values) {
+						return newError(object.ARITY_ERROR, "not enough values to `format`, got %d", len(values))
+					}
+					out.WriteString(values[used].Inspect())
+					used++
+					i++
+				default:
+					out.WriteByte(rest[0])
+				}
+			}
+
+			if used != len(values) {
+				return newError(object.ARITY_ERROR, "too many values to `format`, expected %d got %d", used, len(values))
+			}
+			return &object.String{Value: out.String()}
+		},
+	},
+	"upper": {
+		Doc: "upper(string): returns the string in upper case",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("upper", args, 1)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToUpper(strs[0])}
+		},
+	},
+	"lower": {
+		Doc: "lower(string): returns the string in lower case",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("lower", args, 1)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToLower(strs[0])}
+		},
+	},
+	"trim": {
+		Doc: "trim(string): returns the string without leading and trailing whitespace",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("trim", args, 1)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.TrimSpace(strs[0])}
+		},
+	},
+	"contains": {
+		Doc: "contains(string or array, value): reports whether the substring occurs in the string, or the value in the array",
+		Fn: func(args ...object.Object) object.Object {
+			if array, ok := firstArray(args, 2); ok {
+				return nativeBoolToBooleanObject(indexOf(array, args[1]) >= 0)
+			}
+
+			strs, err := stringArguments("contains", args, 2)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.Contains(strs[0], strs[1]))
+		},
+	},
+	"starts_with": {
+		Doc: "starts_with(string, prefix): reports whether the string begins with the prefix",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("starts_with", args, 2)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.HasPrefix(strs[0], strs[1]))
+		},
+	},
+	"ends_with": {
+		Doc: "ends_with(string, suffix): reports whether the string ends with the suffix",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("ends_with", args, 2)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.HasSuffix(strs[0], strs[1]))
+		},
+	},
+	"index_of": {
+		Doc: "index_of(string or array, value): returns the character index of the first occurrence of the substring in the string, or the index of the value in the array, or -1",
+		Fn: func(args ...object.Object) object.Object {
+			if array, ok := firstArray(args, 2); ok {
+				return object.NewInteger(int64(indexOf(array, args[1])))
+			}
+
+			strs, err := stringArguments("index_of", args, 2)
+			if err != nil {
+				return err
+			}
+
+			// count characters rather than bytes, to match indexing
+			index := strings.Index(strs[0], strs[1])
+			if index < 0 {
+				return object.NewInteger(-1)
+			}
+			return object.NewInteger(int64(utf8.RuneCountInString(strs[0][:index])))
+		},
+	},
+	"type": {
+		Doc: "type(value): returns the name of the type of a value, e.g. \"INTEGER\"",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
+	"is_int":    typePredicate("is_int", "an integer", object.INTEGER_OBJ, object.BIGINT_OBJ),
+	"is_string": typePredicate("is_string", "a string", object.STRING_OBJ),
+	"is_array":  typePredicate("is_array", "an array", object.ARRAY_OBJ),
+	"is_hash":   typePredicate("is_hash", "a hash", object.HASH_OBJ),
+	"is_fn":     typePredicate("is_fn", "a function or builtin", object.FUNCTION_OBJ, object.BUILTIN_OBJ),
+	"is_null":   typePredicate("is_null", "null", object.NULL_OBJ),
+	"int": {
+		Doc: "int(value): converts a string, float, decimal or boolean to an integer; floats and decimals are truncated",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return arg
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError(object.VALUE_ERROR, "cannot convert %s to INTEGER", arg.Inspect())
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return bigIntToObject(value)
+			case *object.Decimal:
+				return bigIntToObject(new(big.Int).Quo(arg.Value.Num(), arg.Value.Denom()))
+			case *object.Boolean:
+				if arg.Value {
+					return object.NewInteger(1)
+				}
+				return object.NewInteger(0)
+			case *object.String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+				if !ok {
+					return newError(object.VALUE_ERROR, "cannot convert %q to INTEGER", arg.Value)
+				}
+				return bigIntToObject(value)
+			default:
+				return newError(object.TYPE_ERROR, "argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"decimal": {
+		Doc: "decimal(value): converts a string such as \"1.23\", an integer or a float to an exact decimal number",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Decimal:
+				return arg
+			case *object.Integer, *object.BigInt:
+				return &object.Decimal{Value: toRat(arg)}
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError(object.VALUE_ERROR, "cannot convert %s to DECIMAL", arg.Inspect())
+				}
+				// the shortest representation, so decimal(0.1) is 0.1 rather than the float's binary expansion
+				value, _ := new(big.Rat).SetString(strconv.FormatFloat(arg.Value, 'g', -1, 64))
+				return &object.Decimal{Value: value}
+			case *object.String:
+				value, ok := new(big.Rat).SetString(strings.TrimSpace(arg.Value))
+				if !ok || strings.Contains(arg.Value, "/") {
+					return newError(object.VALUE_ERROR, "cannot convert %q to DECIMAL", arg.Value)
+				}
+				return &object.Decimal{Value: value}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `decimal` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"bytes": {
+		Doc: "bytes(value): converts a string (as UTF-8) or an array of integers from 0 to 255 to a byte array",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Bytes:
+				return arg
+			case *object.String:
+				return &object.Bytes{Value: []byte(arg.Value)}
+			case *object.Array:
+				value := make([]byte, len(arg.Elements))
+				for i, el := range arg.Elements {
+					b, ok := el.(*object.Integer)
+					if !ok || b.Value < 0 || b.Value > 255 {
+						return newError(object.VALUE_ERROR, "cannot convert %s to a byte", el.Inspect())
+					}
+					value[i] = byte(b.Value)
+				}
+				return &object.Bytes{Value: value}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `bytes` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"to_string": {
+		Doc: "to_string(bytes): decodes a byte array as UTF-8",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			arg, ok := args[0].(*object.Bytes)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `to_string` must be BYTES, got %s", args[0].Type())
+			}
+			if !utf8.Valid(arg.Value) {
+				return newError(object.VALUE_ERROR, "bytes are not valid UTF-8")
+			}
+			return &object.String{Value: string(arg.Value)}
+		},
+	},
+	"str": {
+		Doc: "str(value): returns the printed form of a value as a string",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			if s, ok := args[0].(*object.String); ok {
+				return s
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"bool": {
+		Doc: "bool(value): converts a value to a boolean; zero, empty strings and collections, and null are false, and the strings \"true\" and \"false\" are parsed",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Boolean:
+				return arg
+			case *object.Null:
+				return FALSE
+			case *object.Integer:
+				return nativeBoolToBooleanObject(arg.Value != 0)
+			case *object.BigInt:
+				return TRUE // big integers are never zero
+			case *object.Decimal:
+				return nativeBoolToBooleanObject(arg.Value.Sign() != 0)
+			case *object.Float:
+				return nativeBoolToBooleanObject(arg.Value != 0)
+			case *object.Array:
+				return nativeBoolToBooleanObject(len(arg.Elements) > 0)
+			case *object.Hash:
+				return nativeBoolToBooleanObject(arg.Len() > 0)
+			case *object.String:
+				switch arg.Value {
+				case "true":
+					return TRUE
+				case "false", "":
+					return FALSE
+				default:
+					return newError(object.VALUE_ERROR, "cannot convert %q to BOOLEAN", arg.Value)
+				}
+			default:
+				return newError(object.TYPE_ERROR, "argument to `bool` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"keys": {
+		Doc: "keys(hash): returns an array of the keys of a hash, in the order they were added",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("keys", args, 1)
+			if err != nil {
+				return err
+			}
+
+			keys := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				keys = append(keys, pair.Key)
+			}
+			return &object.Array{Elements: keys}
+		},
+	},
+	"values": {
+		Doc: "values(hash): returns an array of the values of a hash, in the order their keys were added",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("values", args, 1)
+			if err != nil {
+				return err
+			}
+
+			values := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				values = append(values, pair.Value)
+			}
+			return &object.Array{Elements: values}
+		},
+	},
+	"entries": {
+		Doc: "entries(hash): returns an array of the [key, value] pairs of a hash, in the order they were added",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("entries", args, 1)
+			if err != nil {
+				return err
+			}
+
+			entries := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				entries = append(entries, &object.Array{Elements: []object.Object{pair.Key, pair.Value}})
+			}
+			return &object.Array{Elements: entries}
+		},
+	},
+	"get": {
+		Doc: "get(hash, key, default): returns the value of the key, or the optional default (null if not given) when the hash doesn't have it",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 or 3 got=%d", len(args))
+			}
+			hash, err := hashArgument("get", args, len(args))
+			if err != nil {
+				return err
+			}
+
+			if key, ok := args[1].(object.Hashable); ok {
+				if pair, ok := hash.Get(key); ok {
+					return pair.Value
+				}
+			}
+			if len(args) == 3 {
+				return args[2]
+			}
+			return NULL
+		},
+		Allocated: allocatesNothing,
+	},
+	"put": {
+		Doc: "put(hash, key, value): returns a new hash with the key set to the value",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("put", args, 3)
+			if err != nil {
+				return err
+			}
+			if err := refuseFrozen("put", hash); err != nil {
+				return err
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `put` not supported, %s is not hashable", args[1].Type())
+			}
+
+			result := hash.Copy()
+			result.Set(key, args[2])
+			return result
+		},
+	},
+	"delete": {
+		Doc: "delete(hash, key): returns a new hash without the key",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("delete", args, 2)
+			if err != nil {
+				return err
+			}
+			if err := refuseFrozen("delete", hash); err != nil {
+				return err
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `delete` not supported, %s is not hashable", args[1].Type())
+			}
+
+			result := hash.Copy()
+			result.Delete(key)
+			return result
+		},
+	},
+	"merge": {
+		Doc: "merge(a, b): returns a new hash with the pairs of both hashes; b wins when both have a key",
+		Fn: func(args ...object.Object) object.Object {
+			a, err := hashArgument("merge", args, 2)
+			if err != nil {
+				return err
+			}
+			if err := refuseFrozen("merge", a); err != nil {
+				return err
+			}
+			b, ok := args[1].(*object.Hash)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `merge` not supported, got %s", args[1].Type())
+			}
+
+			result := a.Copy()
+			for _, pair := range b.Pairs() {
+				result.Set(pair.Key.(object.Hashable), pair.Value)
+			}
+			return result
+		},
+	},
+	"has_key": {
+		Doc: "has_key(hash, key): reports whether the hash has a value for the key",
+		Fn: func(args ...object.Object) object.Object {
+			hash, err := hashArgument("has_key", args, 2)
+			if err != nil {
+				return err
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return nativeBoolToBooleanObject(false)
+			}
+
+			_, ok = hash.Get(key)
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+	"abs": {
+		Doc: "abs(number): returns the absolute value of a number",
+		Fn: func(args ...object.Object) object.Object {
+			if err := numberArguments("abs", args, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Float:
+				return &object.Float{Value: math.Abs(arg.Value)}
+			default:
+				return bigIntToObject(new(big.Int).Abs(toBigInt(arg)))
 			}
 		},
 	},
+	"min": {
+		Doc: "min(numbers...): returns the smallest of the numbers",
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("min", "<", args)
+		},
+	},
+	"max": {
+		Doc: "max(numbers...): returns the largest of the numbers",
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("max", ">", args)
+		},
+	},
+	"pow": {
+		Doc: "pow(base, exponent): raises the base to the exponent; the result is an integer when both are integers and the exponent isn't negative",
+		Fn: func(args ...object.Object) object.Object {
+			if err := numberArguments("pow", args, 2); err != nil {
+				return err
+			}
+
+			base, exponent := args[0], args[1]
+			if base.Type() != object.FLOAT_OBJ && exponent.Type() != object.FLOAT_OBJ && toBigInt(exponent).Sign() >= 0 {
+				return bigIntToObject(new(big.Int).Exp(toBigInt(base), toBigInt(exponent), nil))
+			}
+			return &object.Float{Value: math.Pow(toFloat(base), toFloat(exponent))}
+		},
+	},
+	"sqrt": {
+		Doc: "sqrt(number): returns the square root of a number as a float",
+		Fn: func(args ...object.Object) object.Object {
+			if err := numberArguments("sqrt", args, 1); err != nil {
+				return err
+			}
+			return &object.Float{Value: math.Sqrt(toFloat(args[0]))}
+		},
+	},
+	"floor": {
+		Doc: "floor(number): returns the greatest integer less than or equal to the number",
+		Fn: func(args ...object.Object) object.Object {
+			if err := numberArguments("floor", args, 1); err != nil {
+				return err
+			}
+			return roundToInteger(args[0], math.Floor)
+		},
+	},
+	"ceil": {
+		Doc: "ceil(number): returns the least integer greater than or equal to the number",
+		Fn: func(args ...object.Object) object.Object {
+			if err := numberArguments("ceil", args, 1); err != nil {
+				return err
+			}
+			return roundToInteger(args[0], math.Ceil)
+		},
+	},
+	"now": {
+		Doc: "now(): returns the current time in milliseconds since the Unix epoch",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=0 got=%d", len(args))
+			}
+			return object.NewInteger(time.Now().UnixMilli())
+		},
+	},
+	"format_time": {
+		Doc: "format_time(ms, layout): formats milliseconds since the Unix epoch in UTC, using a Go layout such as \"2006-01-02 15:04:05\"",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+			}
+
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `format_time` not supported, got %s", args[0].Type())
+			}
+			layout, ok := args[1].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `format_time` must be a STRING, got %s", args[1].Type())
+			}
+			return &object.String{Value: time.UnixMilli(ms.Value).UTC().Format(layout.Value)}
+		},
+	},
+	"next": {
+		Doc: "next(generator): resumes a generator and returns the next value it yields, or null once it has finished",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			generator, ok := args[0].(*object.Generator)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `next` not supported, got %s", args[0].Type())
+			}
+			if value, ok := generator.Resume(); ok {
+				return value
+			}
+			return NULL
+		},
+		Allocated: allocatesNothing,
+	},
+	"wait": {
+		Doc: "wait(handle): blocks until a spawned call has finished and returns its result",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			handle, ok := args[0].(*object.Handle)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `wait` not supported, got %s", args[0].Type())
+			}
+			return handle.Wait()
+		},
+		Allocated: allocatesNothing,
+	},
+	"chan": {
+		Doc: "chan(size): returns a new channel, buffering up to size values (default 0)",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected at most 1 got=%d", len(args))
+			}
+			if len(args) == 0 {
+				return object.NewChannel(0)
+			}
+
+			size, ok := args[0].(*object.Integer)
+			if !ok || size.Value < 0 {
+				return newError(object.VALUE_ERROR, "argument to `chan` must be a non-negative INTEGER, got %s", args[0].Inspect())
+			}
+			return object.NewChannel(int(size.Value))
+		},
+	},
+	"send": {
+		Doc: "send(channel, value): sends a value, blocking until it is received or buffered",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+			}
+
+			channel, ok := args[0].(*object.Channel)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `send` not supported, got %s", args[0].Type())
+			}
+			if !channel.Send(args[1]) {
+				return newError(object.RUNTIME_ERROR, "send on closed channel")
+			}
+			return args[1]
+		},
+	},
+	"recv": {
+		Doc: "recv(channel): receives a value, blocking until one is sent; returns null once the channel is closed",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			channel, ok := args[0].(*object.Channel)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `recv` not supported, got %s", args[0].Type())
+			}
+			if value, ok := channel.Recv(); ok {
+				return value
+			}
+			return NULL
+		},
+		Allocated: allocatesNothing,
+	},
+	"recv_any": {
+		Doc: "recv_any(channels): receives from whichever channel is ready first, returning [index, value]; returns null once all are closed",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `recv_any` not supported, got %s", args[0].Type())
+			}
+			channels := []*object.Channel{}
+			for _, el := range array.Elements {
+				channel, ok := el.(*object.Channel)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `recv_any` must only contain channels, got %s", el.Type())
+				}
+				channels = append(channels, channel)
+			}
+
+			index, value, ok := object.RecvAny(channels)
+			if !ok {
+				return NULL
+			}
+			return &object.Array{Elements: []object.Object{object.NewInteger(int64(index)), value}}
+		},
+	},
+	"close": {
+		Doc: "close(channel): closes a channel, after which receivers get null",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			channel, ok := args[0].(*object.Channel)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `close` not supported, got %s", args[0].Type())
+			}
+			if !channel.Close() {
+				return newError(object.RUNTIME_ERROR, "close of closed channel")
+			}
+			return NULL
+		},
+	},
+	"set": {
+		Doc: "set(array): returns a set of the distinct elements of an array, or an empty set",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected at most 1 got=%d", len(args))
+			}
+
+			set := object.NewSet()
+			if len(args) == 0 {
+				return set
+			}
+
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `set` not supported, got %s", args[0].Type())
+			}
+			return addToSet("set", set, array.Elements)
+		},
+	},
+	"add": {
+		Doc: "add(set, values...): returns a new set with the values added",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected at least 1 got=%d", len(args))
+			}
+
+			set, ok := args[0].(*object.Set)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `add` not supported, got %s", args[0].Type())
+			}
+			return addToSet("add", set.Copy(), args[1:])
+		},
+	},
+	"has": {
+		Doc: "has(set, value): reports whether the value is a member of the set",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+			}
+
+			set, ok := args[0].(*object.Set)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `has` not supported, got %s", args[0].Type())
+			}
+			value, ok := args[1].(object.Hashable)
+			if !ok {
+				return nativeBoolToBooleanObject(false)
+			}
+			return nativeBoolToBooleanObject(set.Has(value))
+		},
+	},
+	"union": {
+		Doc: "union(a, b): returns a new set of the members of either set",
+		Fn: func(args ...object.Object) object.Object {
+			a, b, err := setArguments("union", args)
+			if err != nil {
+				return err
+			}
+			return addToSet("union", a.Copy(), b.Elements())
+		},
+	},
+	"intersect": {
+		Doc: "intersect(a, b): returns a new set of the members of both sets",
+		Fn: func(args ...object.Object) object.Object {
+			a, b, err := setArguments("intersect", args)
+			if err != nil {
+				return err
+			}
+
+			result := object.NewSet()
+			for _, el := range a.Elements() {
+				if b.Has(el.(object.Hashable)) {
+					result.Add(el.(object.Hashable))
+				}
+			}
+			return result
+		},
+	},
+	"regex": {
+		Doc: "regex(pattern): compiles a regular expression, using Go's RE2 syntax",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			pattern, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `regex` not supported, got %s", args[0].Type())
+			}
+			re, err := regexp.Compile(pattern.Value)
+			if err != nil {
+				return newError(object.VALUE_ERROR, "invalid regex: %s", err)
+			}
+			return &object.Regex{Value: re}
+		},
+	},
+	"match": {
+		Doc: "match(string, regex): reports whether the regex matches anywhere in the string",
+		Fn: func(args ...object.Object) object.Object {
+			s, re, err := regexArguments("match", args, 2)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(re.MatchString(s))
+		},
+	},
+	"find_all": {
+		Doc: "find_all(string, regex): returns an array of every match of the regex in the string",
+		Fn: func(args ...object.Object) object.Object {
+			s, re, err := regexArguments("find_all", args, 2)
+			if err != nil {
+				return err
+			}
+
+			matches := []object.Object{}
+			for _, match := range re.FindAllString(s, -1) {
+				matches = append(matches, &object.String{Value: match})
+			}
+			return &object.Array{Elements: matches}
+		},
+	},
+	"replace": {
+		Doc: "replace(string, pattern, replacement): replaces every occurrence of a string or match of a regex; with a regex, $1 in the replacement refers to the first group",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 3 && args[1].Type() == object.STRING_OBJ {
+				strs, err := stringArguments("replace", args, 3)
+				if err != nil {
+					return err
+				}
+				return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+			}
+
+			s, re, err := regexArguments("replace", args, 3)
+			if err != nil {
+				return err
+			}
+
+			replacement, ok := args[2].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `replace` not supported, got %s", args[2].Type())
+			}
+			return &object.String{Value: re.ReplaceAllString(s, replacement.Value)}
+		},
+	},
+	"force": {
+		Doc: "force(value): evaluates a delayed value once and returns the result; other values are returned as is",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			if thunk, ok := args[0].(*object.Thunk); ok {
+				return thunk.Force()
+			}
+			return args[0]
+		},
+		Allocated: allocatesNothing,
+	},
+}
+
+func typePredicate(name string, description string, types ...object.ObjectType) *object.Builtin {
+	return &object.Builtin{
+		Doc: fmt.Sprintf("%s(value): reports whether the value is %s", name, description),
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+			return nativeBoolToBooleanObject(slices.Contains(types, args[0].Type()))
+		},
+	}
+}
+
+// the hash comes first in the arguments of the hash builtins
+func hashArgument(name string, args []object.Object, expected int) (*object.Hash, *object.Error) {
+	if len(args) != expected {
+		return nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, args[0].Type())
+	}
+	return hash, nil
+}
+
+func numberArguments(name string, args []object.Object, expected int) *object.Error {
+	if len(args) != expected {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, arg.Type())
+		}
+	}
+	return nil
+}
+
+// compares with the infix operator, so mixed integers and floats are promoted as usual
+func extremum(name string, operator string, args []object.Object) object.Object {
+	if len(args) < 1 {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. expected at least 1 got=%d", len(args))
+	}
+
+	result := args[0]
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, arg.Type())
+		}
+		if evalInfixExpression(arg, operator, result) == TRUE {
+			result = arg
+		}
+	}
+	return result
+}
+
+func roundToInteger(number object.Object, round func(float64) float64) object.Object {
+	float, ok := number.(*object.Float)
+	if !ok {
+		return number
+	}
+
+	rounded := round(float.Value)
+	if math.IsNaN(rounded) || math.IsInf(rounded, 0) {
+		return newError(object.VALUE_ERROR, "cannot convert %s to INTEGER", float.Inspect())
+	}
+	value, _ := big.NewFloat(rounded).Int(nil)
+	return bigIntToObject(value)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// failed requests are errors, but any response (including 4xx and 5xx) is returned as a hash
+func doRequest(name string, request *http.Request) object.Object {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return newError(object.IO_ERROR, "%s failed: %s", name, err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return newError(object.IO_ERROR, "%s failed to read the response: %s", name, err)
+	}
+
+	names := []string{}
+	for name := range response.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	headers := []object.HashPair{}
+	for _, header := range names {
+		headers = append(headers, stringPair(header, &object.String{Value: strings.Join(response.Header[header], ", ")}))
+	}
+
+	return newHash(
+		stringPair("status", object.NewInteger(int64(response.StatusCode))),
+		stringPair("body", &object.String{Value: string(body)}),
+		stringPair("headers", newHash(headers...)),
+	)
+}
+
+func newHash(pairs ...object.HashPair) *object.Hash {
+	hash := object.NewHash()
+	for _, pair := range pairs {
+		hash.Set(pair.Key.(object.Hashable), pair.Value)
+	}
+	return hash
+}
+
+func stringPair(key string, value object.Object) object.HashPair {
+	return object.HashPair{Key: &object.String{Value: key}, Value: value}
+}
+
+func arrayArgument(name string, args []object.Object, expected int) (*object.Array, *object.Error) {
+	if len(args) != expected {
+		return nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, args[0].Type())
+	}
+	return array, nil
+}
+
+// for the builtins that work on both strings and arrays
+func firstArray(args []object.Object, expected int) (*object.Array, bool) {
+	if len(args) != expected {
+		return nil, false
+	}
+	array, ok := args[0].(*object.Array)
+	return array, ok
+}
+
+// elements are compared like the == operator does
+func indexOf(array *object.Array, value object.Object) int {
+	for i, el := range array.Elements {
+		if objectsEqual(el, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// a result remembered by memo, along with the arguments it's for: different
+// arguments can have the same hash key
+type memoEntry struct {
+	args   []object.Object
+	result object.Object
+}
+
+func lookupMemo(entries []memoEntry, args []object.Object) (object.Object, bool) {
+	for _, entry := range entries {
+		if slices.EqualFunc(entry.args, args, objectsEqual) {
+			return entry.result, true
+		}
+	}
+	return nil, false
+}
+
+// for the builtins that hand back values that were made before, e.g. the
+// elements of their arguments; those have been counted already
+func allocatesNothing(args []object.Object, result object.Object) int {
+	return 0
+}
+
+// frozen values are shared between spawned calls, so everything reachable from them is frozen too
+func freeze(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if !obj.Freeze() {
+			return
+		}
+		for _, el := range obj.Elements {
+			freeze(el)
+		}
+	case *object.Hash:
+		if !obj.Freeze() {
+			return
+		}
+		for _, pair := range obj.Pairs() {
+			freeze(pair.Value)
+		}
+	}
+}
+
+// the builtins making a changed version of an array or hash don't take frozen ones
+func refuseFrozen(name string, obj interface{ Frozen() bool }) *object.Error {
+	if obj.Frozen() {
+		return newError(object.VALUE_ERROR, "argument to `%s` is frozen", name)
+	}
+	return nil
+}
+
+// the string builtins only take strings; the first one is the string being worked on
+func stringArguments(name string, args []object.Object, expected int) ([]string, *object.Error) {
+	if len(args) != expected {
+		return nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	strs := []string{}
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok && i == 0 {
+			return nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, arg.Type())
+		}
+		if !ok {
+			return nil, newError(object.TYPE_ERROR, "argument to `%s` must be a STRING, got %s", name, arg.Type())
+		}
+		strs = append(strs, s.Value)
+	}
+	return strs, nil
+}
+
+// the string and regex that lead the arguments of the regex builtins
+func regexArguments(name string, args []object.Object, expected int) (string, *regexp.Regexp, *object.Error) {
+	if len(args) != expected {
+		return "", nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, args[0].Type())
+	}
+	re, ok := args[1].(*object.Regex)
+	if !ok {
+		return "", nil, newError(object.TYPE_ERROR, "argument to `%s` must be a REGEX, got %s", name, args[1].Type())
+	}
+	return s.Value, re.Value, nil
+}
+
+func addToSet(name string, set *object.Set, values []object.Object) object.Object {
+	for _, value := range values {
+		hashable, ok := value.(object.Hashable)
+		if !ok {
+			return newError(object.TYPE_ERROR, "argument to `%s` not supported, %s is not hashable", name, value.Type())
+		}
+		set.Add(hashable)
+	}
+	return set
+}
+
+func setArguments(name string, args []object.Object) (*object.Set, *object.Set, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 got=%d", len(args))
+	}
+
+	sets := []*object.Set{}
+	for _, arg := range args {
+		set, ok := arg.(*object.Set)
+		if !ok {
+			return nil, nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, arg.Type())
+		}
+		sets = append(sets, set)
+	}
+	return sets[0], sets[1], nil
+}
+
+// builtins that reach outside of the interpreter, left out of sandboxed evaluators
+var unsafeBuiltins = map[string]*object.Builtin{
+	"exec": {
+		Doc: "exec(command, args): runs a command with an optional array of arguments, returning a hash of its stdout, stderr and exit_code",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 or 2 got=%d", len(args))
+			}
+
+			command, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `exec` not supported, got %s", args[0].Type())
+			}
+			commandArgs := []string{}
+			if len(args) == 2 {
+				array, ok := args[1].(*object.Array)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `exec` must be an ARRAY of arguments, got %s", args[1].Type())
+				}
+				for _, el := range array.Elements {
+					arg, ok := el.(*object.String)
+					if !ok {
+						return newError(object.TYPE_ERROR, "arguments passed to `exec` must be strings, got %s", el.Type())
+					}
+					commandArgs = append(commandArgs, arg.Value)
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(command.Value, commandArgs...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			// a command that ran but failed still has a result worth returning
+			err := cmd.Run()
+			if _, ok := err.(*exec.ExitError); err != nil && !ok {
+				return newError(object.IO_ERROR, "exec failed: %s", err)
+			}
+
+			return newHash(
+				stringPair("stdout", &object.String{Value: stdout.String()}),
+				stringPair("stderr", &object.String{Value: stderr.String()}),
+				stringPair("exit_code", object.NewInteger(int64(cmd.ProcessState.ExitCode()))),
+			)
+		},
+	},
+	"env": {
+		Doc: "env(name): returns the value of an environment variable, or null if it isn't set",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			name, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `env` not supported, got %s", args[0].Type())
+			}
+			if value, ok := os.LookupEnv(name.Value); ok {
+				return &object.String{Value: value}
+			}
+			return NULL
+		},
+	},
+	"set_env": {
+		Doc: "set_env(name, value): sets an environment variable for the rest of the program and the commands it runs",
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArguments("set_env", args, 2)
+			if err != nil {
+				return err
+			}
+			if err := os.Setenv(strs[0], strs[1]); err != nil {
+				return newError(object.IO_ERROR, "set_env failed: %s", err)
+			}
+			return NULL
+		},
+	},
+	"http_get": {
+		Doc: "http_get(url): makes a GET request, returning a hash of the response status, body and headers",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+			}
+
+			url, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `http_get` not supported, got %s", args[0].Type())
+			}
+			request, err := http.NewRequest(http.MethodGet, url.Value, nil)
+			if err != nil {
+				return newError(object.IO_ERROR, "http_get failed: %s", err)
+			}
+			return doRequest("http_get", request)
+		},
+	},
+	"http_post": {
+		Doc: "http_post(url, body, headers): makes a POST request with the optional hash of headers, returning a hash of the response status, body and headers",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError(object.ARITY_ERROR, "wrong number of arguments. expected=2 or 3 got=%d", len(args))
+			}
+
+			url, ok := args[0].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `http_post` not supported, got %s", args[0].Type())
+			}
+			body, ok := args[1].(*object.String)
+			if !ok {
+				return newError(object.TYPE_ERROR, "argument to `http_post` must be a STRING body, got %s", args[1].Type())
+			}
+			request, err := http.NewRequest(http.MethodPost, url.Value, strings.NewReader(body.Value))
+			if err != nil {
+				return newError(object.IO_ERROR, "http_post failed: %s", err)
+			}
+
+			if len(args) == 3 {
+				headers, ok := args[2].(*object.Hash)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `http_post` must be a HASH of headers, got %s", args[2].Type())
+				}
+				for _, pair := range headers.Pairs() {
+					name, nameOk := pair.Key.(*object.String)
+					value, valueOk := pair.Value.(*object.String)
+					if !nameOk || !valueOk {
+						return newError(object.TYPE_ERROR, "headers passed to `http_post` must be strings, got %s: %s", pair.Key.Type(), pair.Value.Type())
+					}
+					request.Header.Set(name.Value, value.Value)
+				}
+			}
+			return doRequest("http_post", request)
+		},
+	},
+}
+
+// builtins that need the evaluator running the program, e.g. to write its output
+var evaluatorBuiltins = map[string]func(e *Evaluator) *object.Builtin{
+	"puts": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "puts(values...): prints each value on its own line",
+			Fn: func(args ...object.Object) object.Object {
+				for _, arg := range args {
+					fmt.Fprintln(e.out, arg.Inspect())
+				}
+				return NULL
+			},
+		}
+	},
+	"print": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "print(values...): prints the values separated by spaces, without a trailing newline",
+			Fn: func(args ...object.Object) object.Object {
+				values := make([]string, len(args))
+				for i, arg := range args {
+					values[i] = arg.Inspect()
+				}
+				fmt.Fprint(e.out, strings.Join(values, " "))
+				return NULL
+			},
+		}
+	},
+	"map": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "map(array, f): returns a new array with f applied to each element",
+			Fn: func(args ...object.Object) object.Object {
+				array, f, err := callbackArguments("map", args, 2)
+				if err != nil {
+					return err
+				}
+
+				elements := make([]object.Object, len(array.Elements))
+				for i, el := range array.Elements {
+					result := e.applyFunction(f, []object.Object{el})
+					if isError(result) {
+						return result
+					}
+					elements[i] = result
+				}
+				return &object.Array{Elements: elements}
+			},
+		}
+	},
+	"filter": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "filter(array, f): returns a new array with the elements for which f is truthy",
+			Fn: func(args ...object.Object) object.Object {
+				array, f, err := callbackArguments("filter", args, 2)
+				if err != nil {
+					return err
+				}
+
+				elements := []object.Object{}
+				for _, el := range array.Elements {
+					result := e.applyFunction(f, []object.Object{el})
+					if isError(result) {
+						return result
+					}
+					if isTruthy(result) {
+						elements = append(elements, el)
+					}
+				}
+				return &object.Array{Elements: elements}
+			},
+		}
+	},
+	"reduce": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "reduce(array, initial, f): combines the elements from left to right with f(accumulator, element)",
+			Fn: func(args ...object.Object) object.Object {
+				array, f, err := callbackArguments("reduce", args, 3)
+				if err != nil {
+					return err
+				}
+
+				accumulator := args[1]
+				for _, el := range array.Elements {
+					accumulator = e.applyFunction(f, []object.Object{accumulator, el})
+					if isError(accumulator) {
+						return accumulator
+					}
+				}
+				return accumulator
+			},
+		}
+	},
+	"string_builder": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "string_builder(values...): returns a string builder holding the values; str() turns it into a string",
+			Fn: func(args ...object.Object) object.Object {
+				return writeStrings(e, &object.StringBuilder{}, args)
+			},
+		}
+	},
+	"write": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "write(builder, values...): adds the values to the end of a string builder, in place, and returns it",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected at least 1 got=%d", len(args))
+				}
+				builder, ok := args[0].(*object.StringBuilder)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `write` must be STRING_BUILDER, got %s", args[0].Type())
+				}
+				return writeStrings(e, builder, args[1:])
+			},
+		}
+	},
+	"memo": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "memo(f): returns a function that calls f once for each set of hashable arguments and remembers the results",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+				}
+				f := args[0]
+				switch f.(type) {
+				case *object.Function, *object.Builtin:
+				default:
+					return newError(object.TYPE_ERROR, "argument to `memo` must be a FUNCTION, got %s", f.Type())
+				}
+
+				// memoized functions may be called from spawned calls
+				var mu sync.Mutex
+				cache := make(map[object.HashKey][]memoEntry)
+
+				return &object.Builtin{Doc: "memoized function", Allocated: allocatesNothing, Fn: func(args ...object.Object) object.Object {
+					key, hashable := object.CompositeHashKey(args...)
+					if !hashable {
+						return e.applyFunction(f, args)
+					}
+
+					mu.Lock()
+					result, ok := lookupMemo(cache[key], args)
+					mu.Unlock()
+					if ok {
+						return result
+					}
+
+					// errors aren't remembered, so that a later call can succeed
+					result = e.applyFunction(f, args)
+					if !isError(result) {
+						mu.Lock()
+						cache[key] = append(cache[key], memoEntry{args: args, result: result})
+						mu.Unlock()
+					}
+					return result
+				}}
+			},
+		}
+	},
+	"input": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "input(prompt): prints the optional prompt and returns the next line of input, or null at the end of the input",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected at most 1 got=%d", len(args))
+				}
+				if len(args) == 1 {
+					fmt.Fprint(e.out, args[0].Inspect())
+				}
+
+				line, err := e.in.ReadString('\n')
+				if err != nil && line == "" {
+					if err == io.EOF {
+						return NULL
+					}
+					return newError(object.IO_ERROR, "cannot read input: %s", err)
+				}
+				return &object.String{Value: strings.TrimRight(line, "\r\n")}
+			},
+		}
+	},
+	"args": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "args(): returns the command line arguments passed after the name of the script",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=0 got=%d", len(args))
+				}
+
+				elements := []object.Object{}
+				for _, arg := range e.args {
+					elements = append(elements, &object.String{Value: arg})
+				}
+				return &object.Array{Elements: elements}
+			},
+		}
+	},
+	"clock": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "clock(): returns the milliseconds elapsed since the program started, for timing code",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=0 got=%d", len(args))
+				}
+				// time.Since uses the monotonic clock, so changes to the wall clock don't affect it
+				return &object.Float{Value: float64(time.Since(e.started)) / float64(time.Millisecond)}
+			},
+		}
+	},
+	"rand": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "rand(): returns a random float in [0, 1)",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=0 got=%d", len(args))
+				}
+
+				e.randMu.Lock()
+				defer e.randMu.Unlock()
+				return &object.Float{Value: e.rand.Float64()}
+			},
+		}
+	},
+	"rand_int": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "rand_int(n): returns a random integer in [0, n)",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+				}
+
+				n, ok := args[0].(*object.Integer)
+				if !ok || n.Value <= 0 {
+					return newError(object.VALUE_ERROR, "argument to `rand_int` must be a positive INTEGER, got %s", args[0].Inspect())
+				}
+
+				e.randMu.Lock()
+				defer e.randMu.Unlock()
+				return object.NewInteger(e.rand.Int63n(n.Value))
+			},
+		}
+	},
+	"seed": func(e *Evaluator) *object.Builtin {
+		return &object.Builtin{
+			Doc: "seed(n): seeds the random number generator, so the following random numbers are reproducible",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError(object.ARITY_ERROR, "wrong number of arguments. expected=1 got=%d", len(args))
+				}
+
+				seed, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError(object.TYPE_ERROR, "argument to `seed` not supported, got %s", args[0].Type())
+				}
+
+				e.randMu.Lock()
+				defer e.randMu.Unlock()
+				e.rand.Seed(seed.Value)
+				return NULL
+			},
+		}
+	},
+}
+
+// strings are written as they are, other values in their printed form
+func writeStrings(e *Evaluator, builder *object.StringBuilder, values []object.Object) object.Object {
+	for _, value := range values {
+		s := value.Inspect()
+		if str, ok := value.(*object.String); ok {
+			s = str.Value
+		}
+		if err := e.charge(int64(len(s))); err != nil {
+			return err
+		}
+		builder.Builder.WriteString(s)
+	}
+	return builder
+}
+
+// the array comes first and the callback last, so that they read well as arr.map(f)
+func callbackArguments(name string, args []object.Object, expected int) (*object.Array, object.Object, *object.Error) {
+	if len(args) != expected {
+		return nil, nil, newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", expected, len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError(object.TYPE_ERROR, "argument to `%s` not supported, got %s", name, args[0].Type())
+	}
+
+	f := args[len(args)-1]
+	switch f.(type) {
+	case *object.Function, *object.Builtin:
+		return array, f, nil
+	default:
+		return nil, nil, newError(object.TYPE_ERROR, "argument to `%s` must be a FUNCTION, got %s", name, f.Type())
+	}
+}
+
+// IsBuiltin reports whether name refers to a builtin function
+func IsBuiltin(name string) bool {
+	_, ok := New().builtins.Lookup(name)
+	return ok
+}
+
+// BuiltinNames returns the names of all builtin functions in alphabetical order
+func BuiltinNames() []string {
+	return New().builtins.Names()
+}
+
+// BuiltinDoc returns the usage documentation for a builtin function
+func BuiltinDoc(name string) (string, bool) {
+	builtin, ok := New().builtins.Lookup(name)
+	if !ok {
+		return "", false
+	}
+	return builtin.Doc, true
 }
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"sync/atomic"
+)
+
+// a generator runs the function body on its own goroutine, handing control
+// back and forth with the caller so that only one side runs at a time.
+// Generators that are never run to completion leave their goroutine parked.
+func (e *Evaluator) newGenerator(fn *object.Function, args []object.Object) *object.Generator {
+	values := make(chan object.Object)
+	resume := make(chan struct{})
+	started, finished := false, false
+
+	// the body runs in a call chain of its own, which is the only one it can
+	// yield from, and only while it's running: closures made in the body may
+	// outlive it
+	g := e.fork()
+	var running atomic.Bool
+	g.yield = func(value object.Object) object.Object {
+		if !running.Load() {
+			return newError(object.RUNTIME_ERROR, "yield outside of a running generator")
+		}
+		running.Store(false)
+		values <- value
+		<-resume
+		running.Store(true)
+		return NULL
+	}
+
+	run := func() {
+		defer close(values)
+		defer running.Store(false)
+		running.Store(true)
+
+		evaluated := unwrapReturnValue(g.Eval(fn.Body, extendFunctionEnv(fn, args)))
+		if tailCall, ok := evaluated.(*object.TailCall); ok {
+			evaluated = g.applyFunction(tailCall.Function, tailCall.Arguments)
+		}
+		if isError(evaluated) {
+			values <- evaluated
+		}
+	}
+
+	return &object.Generator{Resume: func() (object.Object, bool) {
+		if finished {
+			return nil, false
+		}
+
+		if !started {
+			started = true
+			go run()
+		} else {
+			resume <- struct{}{}
+		}
+
+		value, ok := <-values
+		if !ok || isError(value) {
+			finished = true
+		}
+		return value, ok
+	}}
+}
+
+// the function and arguments are evaluated before spawning, so mistakes in
+// them are reported straight away
+func (e *Evaluator) evalSpawnExpression(se *ast.SpawnExpression, env *object.Environment) object.Object {
+	function, args := e.evalCall(se.Call, env)
+	if isError(function) {
+		return function
+	}
+
+	handle := object.NewHandle()
+	task := e.fork()
+	go func() {
+		handle.Finish(task.applyFunction(function, args))
+	}()
+	return handle
+}
+
+func (e *Evaluator) evalYieldExpression(ye *ast.YieldExpression, env *object.Environment) object.Object {
+	if e.yield == nil {
+		return newError(object.RUNTIME_ERROR, "yield outside of a generator")
+	}
+
+	value := e.Eval(ye.Value, env)
+	if isError(value) {
+		return value
+	}
+	return e.yield(value)
+}
@@ -1,140 +1,809 @@
 package evaluator
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// shared by evaluators, so that lines buffered by one aren't lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// Evaluator holds the state of a run of a program, such as where its output
+// goes. Spawned calls get an evaluator of their own that shares it, so that
+// each call chain is limited in depth on its own.
+type Evaluator struct {
+	*shared
+
+	depth   atomic.Int64 // calls in progress in this call chain
+	spawned bool
+
+	yield func(object.Object) object.Object // nil unless running a generator
+}
+
+// the state shared by the evaluators of a run
+type shared struct {
+	in       *bufio.Reader
+	out      io.Writer
+	builtins *Registry
+	args     []string
+	started  time.Time
+
+	// spawned calls may share the generator, which isn't safe for concurrent use
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	// cancels the evaluation; spawned calls may outlive the evaluation they started in
+	ctxMu sync.Mutex
+	ctx   context.Context
+
+	maxSteps int64
+	steps    atomic.Int64 // nodes evaluated, counted by spawned calls too
+
+	maxDepth int64
+
+	maxAlloc  int64
+	allocated atomic.Int64 // approximate bytes, counted by spawned calls too
+
+	traceMu sync.Mutex
+	trace   io.Writer // nil unless tracing
+
+	profile *Profile // nil unless profiling
+
+	checkedIntegers bool
+
+	// the definitions run by Reload in each environment, by their source
+	reloadMu sync.Mutex
+	loaded   map[*object.Environment]map[string]bool
+
+	// makes the builtins that need the evaluator, by the ones bound to the
+	// first evaluator, so spawned calls can bind them to their own
+	evaluatorBuiltins map[*object.Builtin]func(*Evaluator) *object.Builtin
+}
+
+// DefaultMaxDepth is how deeply calls may be nested by default, well short
+// of where the Go stack would overflow
+const DefaultMaxDepth = 10000
+
+type Option func(*Evaluator)
+
+// WithInput reads the input of programs (e.g. from `input`) from r instead of stdin.
+// A *bufio.Reader is used as is, so it can be shared with the caller.
+func WithInput(r io.Reader) Option {
+	return func(e *Evaluator) {
+		if reader, ok := r.(*bufio.Reader); ok {
+			e.in = reader
+		} else {
+			e.in = bufio.NewReader(r)
+		}
+	}
+}
+
+// WithOutput sends the output of programs (e.g. from `puts`) to w instead of stdout
+func WithOutput(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.out = w
+	}
+}
+
+// WithSeed seeds the random number generator, so that runs are reproducible
+func WithSeed(seed int64) Option {
+	return func(e *Evaluator) {
+		e.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithArgs sets the command line arguments returned by `args()`
+func WithArgs(args []string) Option {
+	return func(e *Evaluator) {
+		e.args = args
+	}
+}
+
+// WithSandbox leaves out the builtins that reach outside of the interpreter,
+// such as `exec`, `env` and the http builtins
+func WithSandbox() Option {
+	return func(e *Evaluator) {
+		for name := range unsafeBuiltins {
+			e.builtins.Unregister(name)
+		}
+	}
+}
+
+// WithBuiltin makes an extra builtin available to programs, or replaces one of the defaults
+func WithBuiltin(name string, builtin *object.Builtin) Option {
+	return func(e *Evaluator) {
+		e.builtins.Register(name, builtin)
+	}
+}
+
+// WithMaxSteps limits the evaluator to evaluating n nodes, after which
+// evaluation stops with a LimitError. The budget covers everything the
+// evaluator runs, so untrusted programs can't run forever.
+func WithMaxSteps(n int) Option {
+	return func(e *Evaluator) {
+		e.maxSteps = int64(n)
+	}
+}
+
+// WithMaxDepth limits how deeply calls may be nested before evaluation stops
+// with "maximum recursion depth exceeded". Tail calls don't count, and
+// spawned calls are nested on their own.
+func WithMaxDepth(depth int) Option {
+	return func(e *Evaluator) {
+		e.maxDepth = int64(depth)
+	}
+}
+
+// WithMaxAlloc limits the evaluator to allocating roughly n bytes of strings,
+// arrays and hashes, after which evaluation stops with a LimitError. Memory
+// that has been freed again still counts, so the budget is an upper bound on
+// what a program can hold on to.
+func WithMaxAlloc(n int) Option {
+	return func(e *Evaluator) {
+		e.maxAlloc = int64(n)
+	}
+}
+
+// WithTrace logs every node evaluated to w, see SetTrace
+func WithTrace(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.trace = w
+	}
+}
+
+// WithProfile records the calls made by programs in p
+func WithProfile(p *Profile) Option {
+	return func(e *Evaluator) {
+		e.profile = p
+	}
+}
+
+// WithCheckedIntegers makes integer arithmetic that overflows an error,
+// instead of promoting the result to a big integer
+func WithCheckedIntegers() Option {
+	return func(e *Evaluator) {
+		e.checkedIntegers = true
+	}
+}
+
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{shared: &shared{in: stdin, out: os.Stdout, started: time.Now(), ctx: context.Background(), maxDepth: DefaultMaxDepth}}
+	e.rand = rand.New(rand.NewSource(e.started.UnixNano()))
+	e.builtins = defaultRegistry(e)
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// an evaluator for a new call chain, such as that of a spawned call
+func (e *Evaluator) fork() *Evaluator {
+	return &Evaluator{shared: e.shared, spawned: true}
+}
+
+// SetTrace logs every node evaluated from now on to w, along with its position
+// and what it evaluated to, indented by how deeply calls are nested. Nodes are
+// logged once they've been evaluated, so they follow the nodes inside them.
+// A nil w turns tracing off.
+func (e *Evaluator) SetTrace(w io.Writer) {
+	e.traceMu.Lock()
+	defer e.traceMu.Unlock()
+	e.trace = w
+}
+
+func (e *Evaluator) traceNode(node ast.Node, evaluated object.Object) {
+	e.traceMu.Lock()
+	defer e.traceMu.Unlock()
+	if e.trace == nil {
+		return
+	}
+
+	result := "nil"
+	if evaluated != nil {
+		// one line per node
+		result = strings.ReplaceAll(evaluated.Inspect(), "\n", " ")
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	fmt.Fprintf(e.trace, "%s%s %s -> %s\n", strings.Repeat("  ", int(e.depth.Load())), node.Pos(), name, result)
+}
+
+// Builtins returns the registry of the builtins available to programs, which
+// can be changed in between runs
+func (e *Evaluator) Builtins() *Registry {
+	return e.builtins
+}
+
+// Eval evaluates node with a default evaluator
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalCtx evaluates node with a default evaluator, stopping when ctx is done
+func EvalCtx(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalCtx(ctx, node, env)
+}
+
+// EvalCtx evaluates node, stopping with a CancelledError when ctx is done.
+// The context is checked on every loop iteration and function call, so
+// runaway programs can be timed out.
+func (e *Evaluator) EvalCtx(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	e.ctxMu.Lock()
+	outer := e.ctx
+	e.ctx = ctx
+	e.ctxMu.Unlock()
+
+	defer func() {
+		e.ctxMu.Lock()
+		e.ctx = outer
+		e.ctxMu.Unlock()
+	}()
+
+	return e.Eval(node, env)
+}
+
+// returns an error once the context of the evaluation is done
+func (e *Evaluator) cancelled() *object.Error {
+	e.ctxMu.Lock()
+	ctx := e.ctx
+	e.ctxMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return newError(object.CANCELLED_ERROR, "%s", err)
+	}
+	return nil
+}
+
+// charges a newly made value to the allocation budget, returning an error in
+// its place once the budget has run out
+func (e *Evaluator) allocate(obj object.Object) object.Object {
+	if e.maxAlloc <= 0 {
+		return obj
+	}
+
+	// roughly what the values take up, not counting their elements
+	var size int64
+	switch obj := obj.(type) {
+	case *object.String:
+		size = int64(len(obj.Value))
+	case *object.Bytes:
+		size = int64(len(obj.Value))
+	case *object.Array:
+		size = elementSize * int64(len(obj.Elements))
+	case *object.Hash:
+		size = pairSize * int64(obj.Len())
+	default:
+		return obj
+	}
+
+	if err := e.charge(size); err != nil {
+		return err
+	}
+	return obj
+}
+
+// what an element of an array and a pair of a hash roughly take up
+const (
+	elementSize = 16
+	pairSize    = 64
+)
+
+// charges what a builtin allocated to the budget: what it reports, or else
+// its result, unless that's one of the arguments handed back
+func (e *Evaluator) allocateBuiltin(fn *object.Builtin, args []object.Object, result object.Object) object.Object {
+	if e.maxAlloc <= 0 || isError(result) {
+		return result
+	}
+
+	if fn.Allocated != nil {
+		if err := e.charge(int64(fn.Allocated(args, result))); err != nil {
+			return err
+		}
+		return result
+	}
+	for _, arg := range args {
+		if arg == result {
+			return result
+		}
+	}
+	return e.allocate(result)
+}
+
+// charges size bytes to the allocation budget
+func (e *Evaluator) charge(size int64) *object.Error {
+	if e.maxAlloc > 0 && e.allocated.Add(size) > e.maxAlloc {
+		return newError(object.LIMIT_ERROR, "allocation limit of %d bytes exceeded", e.maxAlloc)
+	}
+	return nil
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+	return e.finish(node, e.eval(node, env))
+}
+
+// counts a node against the step budget
+func (e *Evaluator) step() *object.Error {
+	if e.maxSteps > 0 && e.steps.Add(1) > e.maxSteps {
+		return newError(object.LIMIT_ERROR, "step limit of %d exceeded", e.maxSteps)
+	}
+	return nil
+}
+
+// what happens to every node once it has been evaluated
+func (e *Evaluator) finish(node ast.Node, evaluated object.Object) object.Object {
+	switch node.(type) {
+	case *ast.StringLiteral, *ast.ArrayLiteral, *ast.HashLiteral, *ast.InfixExpression, *ast.SliceExpression:
+		evaluated = e.allocate(evaluated)
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		locateError(err, node)
+	}
+	e.traceNode(node, evaluated)
+	return evaluated
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return e.evalProgram(node.Statements, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 
 	case *ast.BooleanExpression:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.checkOverflow(evalPrefixExpression(node.Operator, right), right)
 
 	case *ast.InfixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
-			return right
-		}
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
 		}
-		return evalInfixExpression(left, node.Operator, right)
+
+		return e.evalInfixChain(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.WhileExpression:
+		return e.evalWhileExpression(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+
+	case *ast.SpawnExpression:
+		return e.evalSpawnExpression(node, env)
+
+	case *ast.YieldExpression:
+		return e.evalYieldExpression(node, env)
+
+	case *ast.DelayExpression:
+		return &object.Thunk{Compute: func() object.Object { return unwrapReturnValue(e.Eval(node.Value, env)) }}
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.ReturnStatement:
-		return evalReturnStatement(node, env)
+		return e.evalReturnStatement(node, env)
+
+	case *ast.ThrowStatement:
+		return e.evalThrowStatement(node, env)
 
 	case *ast.LetStatement:
-		return evalLetStatement(node, env)
+		return e.evalLetStatement(node, env)
+
+	case *ast.EnumStatement:
+		variants := []string{}
+		for _, variant := range node.Variants {
+			variants = append(variants, variant.Value)
+		}
+		return env.Set(node.Name.Value, object.NewEnum(node.Name.Value, variants))
+
+	case *ast.FunctionStatement:
+		// bound in the environment the function closes over, so it can call itself
+		function := &object.Function{Parameters: node.Function.Parameters, Body: node.Function.Body, Env: env, Generator: node.Function.Generator}
+		return env.Set(node.Name.Value, function)
+
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteralExpression:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, Generator: node.Generator}
 
 	case *ast.FunctionCallExpression:
-		function := Eval(node.Function, env)
+		function, args := e.evalCall(node, env)
 		if isError(function) {
-			fmt.Printf("problem inital Eval: %s\n", function.Inspect())
 			return function
 		}
 
-		args := evalExpressions(node.Parameters, env)
-		if len(args) == 1 && isError(args[0]) {
-			fmt.Printf("problem with parameters: %s\n", args[0].Inspect())
-			return args[0]
+		// left for applyFunction to make once the current call has returned
+		if fn, ok := function.(*object.Function); ok && node.Tail {
+			return &object.TailCall{Function: fn, Arguments: args}
 		}
 
-		return applyFunction(function, args)
+		started := time.Now()
+		result := e.applyFunction(function, args)
+		if e.profile != nil {
+			var pos token.Position
+			if fn, ok := function.(*object.Function); ok {
+				pos = fn.Body.Pos()
+			}
+			e.profile.record(calleeName(node.Function), pos, time.Since(started))
+		}
+		if err, ok := result.(*object.Error); ok && function.Type() == object.FUNCTION_OBJ {
+			err.Trace = append(err.Trace, object.Frame{Function: calleeName(node.Function), Line: node.Token.Line, Column: node.Token.Column})
+		}
+		return result
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
-			return elements[0]
+		elements, err := e.evalExpressions(node.Elements, env)
+		if err != nil {
+			return err
 		}
 		return &object.Array{Elements: elements}
 
+	case *ast.SpreadExpression:
+		return newError(object.RUNTIME_ERROR, "spread is only allowed in function calls and array literals")
+
 	case *ast.HashLiteral:
-		pairs := make(map[object.HashKey]object.HashPair)
-		for k, v := range node.Pairs {
-			value := Eval(v, env)
-			keyObj := Eval(k, env)
-			if hashableObj, ok := keyObj.(object.Hashable); !ok {
-				return newError("Cannot use as key %s", keyObj.Type())
-			} else {
-				pairs[hashableObj.HashKey()] = object.HashPair{Key: keyObj, Value: value}
+		hash := object.NewHash()
+		for _, pair := range node.Pairs {
+			keyObj := e.Eval(pair.Key, env)
+			if isError(keyObj) {
+				return keyObj
+			}
+			hashableObj, ok := keyObj.(object.Hashable)
+			if !ok {
+				err := newError(object.TYPE_ERROR, "Cannot use as key %s", keyObj.Type())
+				locateError(err, pair.Key)
+				return err
 			}
+			value := e.Eval(pair.Value, env)
+			if isError(value) {
+				return value
+			}
+			hash.Set(hashableObj, value)
 		}
-		return &object.Hash{Pairs: pairs}
+		return hash
 
 	case *ast.IndexingExpression:
-		target := Eval(node.Target, env)
+		target := e.Eval(node.Target, env)
+		if node.Optional && target == NULL {
+			return NULL
+		}
 		switch target := target.(type) {
 		case *object.Array:
-			evaluatedIndex := Eval(node.Index, env)
+			evaluatedIndex := e.Eval(node.Index, env)
 			if evaluatedIndex.Type() != object.INTEGER_OBJ {
-				return newError("Cannot use as index %s", evaluatedIndex.Type())
+				return newError(object.TYPE_ERROR, "Cannot use as index %s", evaluatedIndex.Type())
 			}
 			index := evaluatedIndex.(*object.Integer)
 
 			if index.Value < 0 {
-				return newError("Cannot index with a negative number %d", index.Value)
+				return newError(object.INDEX_ERROR, "Cannot index with a negative number %d", index.Value)
 			}
 
 			if index.Value >= int64(len(target.Elements)) {
-				return newError("Index is larger than the max. index=%d, max=%d", index.Value, len(target.Elements)-1)
+				return newError(object.INDEX_ERROR, "Index is larger than the max. index=%d, max=%d", index.Value, len(target.Elements)-1)
 			}
 
 			return target.Elements[index.Value]
+		case *object.String:
+			evaluatedIndex := e.Eval(node.Index, env)
+			if evaluatedIndex.Type() != object.INTEGER_OBJ {
+				return newError(object.TYPE_ERROR, "Cannot use as index %s", evaluatedIndex.Type())
+			}
+			index := evaluatedIndex.(*object.Integer)
+
+			if index.Value < 0 {
+				return newError(object.INDEX_ERROR, "Cannot index with a negative number %d", index.Value)
+			}
+
+			// index by character rather than by byte
+			runes := []rune(target.Value)
+			if index.Value >= int64(len(runes)) {
+				return newError(object.INDEX_ERROR, "Index is larger than the max. index=%d, max=%d", index.Value, len(runes)-1)
+			}
+
+			return &object.String{Value: string(runes[index.Value])}
+		case *object.Bytes:
+			evaluatedIndex := e.Eval(node.Index, env)
+			if evaluatedIndex.Type() != object.INTEGER_OBJ {
+				return newError(object.TYPE_ERROR, "Cannot use as index %s", evaluatedIndex.Type())
+			}
+			index := evaluatedIndex.(*object.Integer)
+
+			if index.Value < 0 {
+				return newError(object.INDEX_ERROR, "Cannot index with a negative number %d", index.Value)
+			}
+
+			if index.Value >= int64(len(target.Value)) {
+				return newError(object.INDEX_ERROR, "Index is larger than the max. index=%d, max=%d", index.Value, len(target.Value)-1)
+			}
+
+			return object.NewInteger(int64(target.Value[index.Value]))
 		case *object.Hash:
-			evaluatedIndex := Eval(node.Index, env)
+			evaluatedIndex := e.Eval(node.Index, env)
 
 			if hashableObj, ok := evaluatedIndex.(object.Hashable); !ok {
-				return newError("Cannot use as index %s", evaluatedIndex.Type())
+				return newError(object.TYPE_ERROR, "Cannot use as index %s", evaluatedIndex.Type())
 			} else {
-				return target.Pairs[hashableObj.HashKey()].Value
+				pair, ok := target.Get(hashableObj)
+				if !ok {
+					return NULL
+				}
+				return pair.Value
 			}
 		default:
-			return newError("Cannot index type %s", target.Type())
+			return newError(object.TYPE_ERROR, "Cannot index type %s", target.Type())
 		}
+
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+
+	case *ast.AccessExpression:
+		return e.evalAccessExpression(node, env)
 	}
 
 	return nil
 }
 
+// chains like 1 + 2 + ... + n nest to the left, as deeply as they are long,
+// so rather than recursing down the left side, the chain is evaluated in a
+// loop. As in a single infix expression, right operands are evaluated first.
+func (e *Evaluator) evalInfixChain(node *ast.InfixExpression, env *object.Environment) object.Object {
+	chain := []*ast.InfixExpression{node}
+	for {
+		left, ok := chain[len(chain)-1].Left.(*ast.InfixExpression)
+		if !ok || left.Operator == "&&" || left.Operator == "||" {
+			break
+		}
+		if err := e.step(); err != nil {
+			return err
+		}
+		chain = append(chain, left)
+	}
+
+	// the links inside node are finished as if they had been evaluated on their own
+	unwind := func(evaluated object.Object, from int) object.Object {
+		for i := from; i > 0; i-- {
+			evaluated = e.finish(chain[i], evaluated)
+		}
+		return evaluated
+	}
+
+	rights := make([]object.Object, len(chain))
+	for i, link := range chain {
+		rights[i] = e.Eval(link.Right, env)
+		if isError(rights[i]) {
+			return unwind(rights[i], i)
+		}
+	}
+
+	last := len(chain) - 1
+	result := e.Eval(chain[last].Left, env)
+	if isError(result) {
+		return unwind(result, last)
+	}
+
+	for i := last; i >= 0; i-- {
+		left := result
+		result = e.checkOverflow(evalInfixExpression(left, chain[i].Operator, rights[i]), left, rights[i])
+		if i == 0 {
+			break
+		}
+		result = e.finish(chain[i], result)
+		if isError(result) {
+			return unwind(result, i-1)
+		}
+	}
+	return result
+}
+
+func (e *Evaluator) evalAccessExpression(ae *ast.AccessExpression, env *object.Environment) object.Object {
+	target := e.Eval(ae.Target, env)
+	if isError(target) {
+		return target
+	}
+	if ae.Optional && target == NULL {
+		return NULL
+	}
+
+	if enum, ok := target.(*object.Enum); ok {
+		variant, ok := enum.Variant(ae.Key.Value)
+		if !ok {
+			return newError(object.NAME_ERROR, "enum %s has no variant %s", enum.Name, ae.Key.Value)
+		}
+		return variant
+	}
+
+	hash, ok := target.(*object.Hash)
+	if !ok {
+		return newError(object.TYPE_ERROR, "cannot access %s on %s", ae.Key.Value, target.Type())
+	}
+
+	pair, ok := hash.Get(&object.String{Value: ae.Key.Value})
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+func (e *Evaluator) evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	target := e.Eval(se.Target, env)
+	if isError(target) {
+		return target
+	}
+
+	switch target := target.(type) {
+	case *object.Array:
+		start, end, err := e.evalSliceBounds(se, len(target.Elements), env)
+		if err != nil {
+			return err
+		}
+		elements := make([]object.Object, end-start)
+		copy(elements, target.Elements[start:end])
+		return &object.Array{Elements: elements}
+	case *object.String:
+		// slice by character rather than by byte
+		runes := []rune(target.Value)
+		start, end, err := e.evalSliceBounds(se, len(runes), env)
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: string(runes[start:end])}
+	case *object.Bytes:
+		start, end, err := e.evalSliceBounds(se, len(target.Value), env)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, end-start)
+		copy(value, target.Value[start:end])
+		return &object.Bytes{Value: value}
+	default:
+		return newError(object.TYPE_ERROR, "Cannot slice type %s", target.Type())
+	}
+}
+
+// missing bounds default to the whole target, and all bounds are clamped to it
+func (e *Evaluator) evalSliceBounds(se *ast.SliceExpression, length int, env *object.Environment) (int, int, *object.Error) {
+	bounds := []int{0, length}
+
+	for i, exp := range []ast.Expression{se.Start, se.Stop} {
+		if exp == nil {
+			continue
+		}
+
+		evaluated := e.Eval(exp, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			return 0, 0, err
+		}
+		bound, ok := evaluated.(*object.Integer)
+		if !ok {
+			return 0, 0, newError(object.TYPE_ERROR, "Cannot use as slice bound %s", evaluated.Type())
+		}
+
+		bounds[i] = int(max(0, min(bound.Value, int64(length))))
+	}
+
+	start, end := bounds[0], max(bounds[0], bounds[1])
+	return start, end, nil
+}
+
+// how a called function is shown in stack traces
+func calleeName(function ast.Expression) string {
+	switch function := function.(type) {
+	case *ast.AccessExpression:
+		return function.Key.Value
+	case *ast.FunctionLiteralExpression:
+		return "fn"
+	default:
+		return function.String()
+	}
+}
+
+// stands in for the method of a null receiver in recv?.f()
+var returnNull = &object.Builtin{Fn: func(args ...object.Object) object.Object { return NULL }}
+
+// evaluates the function and arguments of a call without making it.
+// Errors are returned in place of the function.
+func (e *Evaluator) evalCall(call *ast.FunctionCallExpression, env *object.Environment) (object.Object, []object.Object) {
+	if access, ok := call.Function.(*ast.AccessExpression); ok {
+		return e.evalMethodCall(access, call.Parameters, env)
+	}
+
+	function := e.Eval(call.Function, env)
+	if isError(function) {
+		return function, nil
+	}
+
+	args, err := e.evalArguments(call.Function, call.Parameters, env)
+	if err != nil {
+		return err, nil
+	}
+
+	return function, args
+}
+
+// recv.f(args) calls a function stored in the hash recv under "f";
+// otherwise it is uniform function call syntax for f(recv, args)
+func (e *Evaluator) evalMethodCall(access *ast.AccessExpression, parameters []ast.Expression, env *object.Environment) (object.Object, []object.Object) {
+	receiver := e.Eval(access.Target, env)
+	if isError(receiver) {
+		return receiver, nil
+	}
+	if access.Optional && receiver == NULL {
+		return returnNull, nil
+	}
+
+	args, err := e.evalArguments(access, parameters, env)
+	if err != nil {
+		return err, nil
+	}
+
+	if hash, ok := receiver.(*object.Hash); ok {
+		if pair, ok := hash.Get(&object.String{Value: access.Key.Value}); ok {
+			return pair.Value, args
+		}
+	}
+
+	function := e.evalIdentifier(access.Key, env)
+	if isError(function) {
+		return function, nil
+	}
+
+	return function, append([]object.Object{receiver}, args...)
+}
+
 func isHashIndexType(obj object.Object) bool {
 	switch obj.Type() {
 	case object.INTEGER_OBJ:
@@ -149,31 +818,35 @@ func isHashIndexType(obj object.Object) bool {
 }
 
 // returns the evalutation of the LAST statement
-func evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range statements {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			err := newError(object.RUNTIME_ERROR, "%s outside of a loop", result.Inspect())
+			locateError(err, stmt)
+			return err
 		}
 	}
 
 	return result
 }
 
-func evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range blockStatement.Statements {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -182,6 +855,19 @@ func evalBlockStatement(blockStatement *ast.BlockStatement, env *object.Environm
 	return result
 }
 
+// arithmetic on plain integers only has a big integer result if it overflowed
+func (e *Evaluator) checkOverflow(result object.Object, operands ...object.Object) object.Object {
+	if !e.checkedIntegers || result.Type() != object.BIGINT_OBJ {
+		return result
+	}
+	for _, operand := range operands {
+		if operand.Type() != object.INTEGER_OBJ {
+			return result
+		}
+	}
+	return newError(object.VALUE_ERROR, "integer overflow")
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -197,7 +883,7 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusOperatorExpression(right)
 	default:
-		return newError("unkown operator: %s%s", operator, right.Type())
+		return newError(object.TYPE_ERROR, "unkown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -210,28 +896,114 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 			right.(*object.Integer),
 		)
 
+	case isDecimalArithmetic(left, right):
+		// integers are promoted to decimals, floats would lose the exactness
+		return evalDecimalInfixOperator(toRat(left), operator, toRat(right))
+
+	case isNumber(left) && isNumber(right) && (left.Type() == object.FLOAT_OBJ || right.Type() == object.FLOAT_OBJ):
+		// mixed arithmetic promotes integers to floats
+		return evalFloatInfixOperator(toFloat(left), operator, toFloat(right))
+
+	case isNumber(left) && isNumber(right):
+		// at least one side is a big integer
+		return evalBigIntInfixOperator(toBigInt(left), operator, toBigInt(right))
+
 	case right.Type() == object.STRING_OBJ && left.Type() == object.STRING_OBJ:
-		if operator == "+" {
-			return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
-		}
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+		return evalStringInfixOperator(
+			left.(*object.String),
+			operator,
+			right.(*object.String),
+		)
 
 	case operator == "==":
-		// the == and != operators do pointer comparison for boolean and NULL
-		// other evaluations (string, objects etc) need to happen before this point
-		return nativeBoolToBooleanObject(left == right)
+		// collections are compared structurally, everything else (e.g. boolean
+		// and NULL) by pointer; strings and numbers need to happen before this point
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 
 	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 
 }
 
+// reports whether two values are deeply equal, following the == operator for
+// numbers and strings
+func objectsEqual(left object.Object, right object.Object) bool {
+	switch left := left.(type) {
+	case *object.Array:
+		right, ok := right.(*object.Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for i := range left.Elements {
+			if !objectsEqual(left.Elements[i], right.Elements[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *object.Hash:
+		right, ok := right.(*object.Hash)
+		if !ok || left.Len() != right.Len() {
+			return false
+		}
+		for _, pair := range left.Pairs() {
+			other, ok := right.Get(pair.Key.(object.Hashable))
+			if !ok || !objectsEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+
+	case *object.Bytes:
+		right, ok := right.(*object.Bytes)
+		return ok && bytes.Equal(left.Value, right.Value)
+
+	case *object.Set:
+		right, ok := right.(*object.Set)
+		if !ok || left.Len() != right.Len() {
+			return false
+		}
+		for _, el := range left.Elements() {
+			if !right.Has(el.(object.Hashable)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if (isNumber(left) && isNumber(right)) || isDecimalArithmetic(left, right) || (left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ) {
+		return evalInfixExpression(left, "==", right) == TRUE
+	}
+	return left == right
+}
+
+// the right operand is only evaluated when the left one doesn't already decide the result
+func (e *Evaluator) evalLogicalExpression(ie *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(ie.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if ie.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if ie.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := e.Eval(ie.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalBangOperatorExpression(exp object.Object) object.Object {
 	switch exp {
 	case TRUE:
@@ -248,24 +1020,172 @@ func evalBangOperatorExpression(exp object.Object) object.Object {
 }
 
 func evalMinusOperatorExpression(exp object.Object) object.Object {
-	if exp.Type() != object.INTEGER_OBJ {
-		return newError("unkown operator: -%s", exp.Type())
+	switch exp := exp.(type) {
+	case *object.Integer:
+		if exp.Value == math.MinInt64 {
+			return bigIntToObject(new(big.Int).Neg(big.NewInt(exp.Value)))
+		}
+		return object.NewInteger(-exp.Value)
+	case *object.Float:
+		return &object.Float{Value: -exp.Value}
+	case *object.BigInt:
+		return bigIntToObject(new(big.Int).Neg(exp.Value))
+	case *object.Decimal:
+		return &object.Decimal{Value: new(big.Rat).Neg(exp.Value)}
+	default:
+		return newError(object.TYPE_ERROR, "unkown operator: -%s", exp.Type())
 	}
-
-	value := exp.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalIntegerInfixOperator(left *object.Integer, operator string, right *object.Integer) object.Object {
 	switch operator {
 	case "+":
-		return &object.Integer{Value: left.Value + right.Value}
+		result := left.Value + right.Value
+		// overflowed if both operands have the same sign and the result doesn't
+		if (left.Value >= 0) == (right.Value >= 0) && (result >= 0) != (left.Value >= 0) {
+			return evalBigIntInfixOperator(big.NewInt(left.Value), operator, big.NewInt(right.Value))
+		}
+		return object.NewInteger(result)
+	case "-":
+		result := left.Value - right.Value
+		if (left.Value >= 0) != (right.Value >= 0) && (result >= 0) != (left.Value >= 0) {
+			return evalBigIntInfixOperator(big.NewInt(left.Value), operator, big.NewInt(right.Value))
+		}
+		return object.NewInteger(result)
+	case "*":
+		result := left.Value * right.Value
+		if left.Value != 0 && (result/left.Value != right.Value || (left.Value == -1 && right.Value == math.MinInt64)) {
+			return evalBigIntInfixOperator(big.NewInt(left.Value), operator, big.NewInt(right.Value))
+		}
+		return object.NewInteger(result)
+	case "/":
+		if right.Value == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
+		if left.Value == math.MinInt64 && right.Value == -1 {
+			return evalBigIntInfixOperator(big.NewInt(left.Value), operator, big.NewInt(right.Value))
+		}
+		return object.NewInteger(left.Value / right.Value)
+	case "==":
+		return nativeBoolToBooleanObject(left.Value == right.Value)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Value != right.Value)
+	case ">":
+		return nativeBoolToBooleanObject(left.Value > right.Value)
+	case "<":
+		return nativeBoolToBooleanObject(left.Value < right.Value)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Value >= right.Value)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Value <= right.Value)
+	default:
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalBigIntInfixOperator(left *big.Int, operator string, right *big.Int) object.Object {
+	switch operator {
+	case "+":
+		return bigIntToObject(new(big.Int).Add(left, right))
 	case "-":
-		return &object.Integer{Value: left.Value - right.Value}
+		return bigIntToObject(new(big.Int).Sub(left, right))
 	case "*":
-		return &object.Integer{Value: left.Value * right.Value}
+		return bigIntToObject(new(big.Int).Mul(left, right))
 	case "/":
-		return &object.Integer{Value: left.Value / right.Value}
+		if right.Sign() == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
+		// Quo truncates towards zero, like int64 division
+		return bigIntToObject(new(big.Int).Quo(left, right))
+	case "==":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0)
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Cmp(right) >= 0)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Cmp(right) <= 0)
+	default:
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", object.BIGINT_OBJ, operator, object.BIGINT_OBJ)
+	}
+}
+
+// results that fit back into an int64 are demoted to plain integers
+func bigIntToObject(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return object.NewInteger(value.Int64())
+	}
+	return &object.BigInt{Value: value}
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	}
+	return new(big.Int)
+}
+
+func evalDecimalInfixOperator(left *big.Rat, operator string, right *big.Rat) object.Object {
+	switch operator {
+	case "+":
+		return &object.Decimal{Value: new(big.Rat).Add(left, right)}
+	case "-":
+		return &object.Decimal{Value: new(big.Rat).Sub(left, right)}
+	case "*":
+		return &object.Decimal{Value: new(big.Rat).Mul(left, right)}
+	case "/":
+		if right.Sign() == 0 {
+			return newError(object.VALUE_ERROR, "division by zero")
+		}
+		return &object.Decimal{Value: new(big.Rat).Quo(left, right)}
+	case "==":
+		return nativeBoolToBooleanObject(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(left.Cmp(right) != 0)
+	case ">":
+		return nativeBoolToBooleanObject(left.Cmp(right) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(left.Cmp(right) < 0)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Cmp(right) >= 0)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Cmp(right) <= 0)
+	default:
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", object.DECIMAL_OBJ, operator, object.DECIMAL_OBJ)
+	}
+}
+
+// decimals mix with integers, but not with floats
+func isDecimalArithmetic(left object.Object, right object.Object) bool {
+	isOperand := func(obj object.Object) bool {
+		switch obj.Type() {
+		case object.DECIMAL_OBJ, object.INTEGER_OBJ, object.BIGINT_OBJ:
+			return true
+		default:
+			return false
+		}
+	}
+	return (left.Type() == object.DECIMAL_OBJ || right.Type() == object.DECIMAL_OBJ) && isOperand(left) && isOperand(right)
+}
+
+func toRat(obj object.Object) *big.Rat {
+	if obj, ok := obj.(*object.Decimal); ok {
+		return obj.Value
+	}
+	return new(big.Rat).SetInt(toBigInt(obj))
+}
+
+func evalStringInfixOperator(left *object.String, operator string, right *object.String) object.Object {
+	switch operator {
+	case "+":
+		return &object.String{Value: left.Value + right.Value}
 	case "==":
 		return nativeBoolToBooleanObject(left.Value == right.Value)
 	case "!=":
@@ -274,26 +1194,107 @@ func evalIntegerInfixOperator(left *object.Integer, operator string, right *obje
 		return nativeBoolToBooleanObject(left.Value > right.Value)
 	case "<":
 		return nativeBoolToBooleanObject(left.Value < right.Value)
+	case ">=":
+		return nativeBoolToBooleanObject(left.Value >= right.Value)
+	case "<=":
+		return nativeBoolToBooleanObject(left.Value <= right.Value)
 	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func evalFloatInfixOperator(left float64, operator string, right float64) object.Object {
+	switch operator {
+	case "+":
+		return &object.Float{Value: left + right}
+	case "-":
+		return &object.Float{Value: left - right}
+	case "*":
+		return &object.Float{Value: left * right}
+	case "/":
+		return &object.Float{Value: left / right}
+	case "==":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case ">":
+		return nativeBoolToBooleanObject(left > right)
+	case "<":
+		return nativeBoolToBooleanObject(left < right)
+	case ">=":
+		return nativeBoolToBooleanObject(left >= right)
+	case "<=":
+		return nativeBoolToBooleanObject(left <= right)
+	default:
+		return newError(object.TYPE_ERROR, "unkown operator: %s %s %s", object.FLOAT_OBJ, operator, object.FLOAT_OBJ)
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	switch obj.Type() {
+	case object.INTEGER_OBJ, object.BIGINT_OBJ, object.FLOAT_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	}
+	return 0
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+func (e *Evaluator) evalWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
+	for {
+		if err := e.cancelled(); err != nil {
+			return err
+		}
+
+		condition := e.Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		evaluated := e.Eval(we.Body, env)
+		if evaluated == nil {
+			continue
+		}
+
+		switch evaluated.Type() {
+		case object.BREAK_OBJ:
+			return NULL
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return evaluated
+		}
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case TRUE:
@@ -307,16 +1308,80 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) object.Object {
-	value := Eval(rs.ReturnValue, env)
+func (e *Evaluator) evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) object.Object {
+	value := e.Eval(rs.ReturnValue, env)
 	if isError(value) {
 		return value
 	}
 	return &object.ReturnValue{Value: value}
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func (e *Evaluator) evalThrowStatement(ts *ast.ThrowStatement, env *object.Environment) object.Object {
+	value := e.Eval(ts.Value, env)
+	if isError(value) {
+		return value
+	}
+	return &object.Error{Kind: object.THROWN_ERROR, Message: value.Inspect(), Value: value}
+}
+
+// the handler sees thrown values as they are, and runtime errors as a hash
+// of their kind, message and position
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	evaluated := e.Eval(te.Body, env)
+
+	err, ok := evaluated.(*object.Error)
+	if !ok || uncatchable(err) {
+		return evaluated
+	}
+
+	var caught object.Object = newHash(
+		stringPair("kind", &object.String{Value: string(err.Kind)}),
+		stringPair("message", &object.String{Value: err.Message}),
+		stringPair("line", object.NewInteger(int64(err.Line))),
+		stringPair("column", object.NewInteger(int64(err.Column))),
+	)
+	if err.Value != nil {
+		caught = err.Value
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	handlerEnv.Set(te.Param.Value, caught)
+	return e.Eval(te.Handler, handlerEnv)
+}
+
+// errors raised by the host rather than the program go straight through try
+func uncatchable(err *object.Error) bool {
+	return err.Kind == object.CANCELLED_ERROR || err.Kind == object.LIMIT_ERROR
+}
+
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// errors are located at the innermost node they come out of: at the operator
+// of operations, so that errors in a + b point at the +, and at the start of
+// other nodes
+func locateError(err *object.Error, node ast.Node) {
+	if err.Line != 0 {
+		return
+	}
+
+	pos := node.Pos()
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		pos = node.Token.Pos()
+	case *ast.AssignExpression:
+		pos = node.Token.Pos()
+	case *ast.FunctionCallExpression:
+		pos = node.Token.Pos()
+	case *ast.IndexingExpression:
+		pos = node.Token.Pos()
+	case *ast.SliceExpression:
+		pos = node.Token.Pos()
+	case *ast.AccessExpression:
+		pos = node.Token.Pos()
+	}
+	err.Line, err.Column = pos.Line, pos.Column
 }
 
 func isError(obj object.Object) bool {
@@ -327,56 +1392,188 @@ func isError(obj object.Object) bool {
 	return obj.Type() == object.ERROR_OBJ
 }
 
-func evalLetStatement(ls *ast.LetStatement, env *object.Environment) object.Object {
-	val := Eval(ls.Value, env)
+func (e *Evaluator) evalLetStatement(ls *ast.LetStatement, env *object.Environment) object.Object {
+	// let x; binds x to null
+	var val object.Object = NULL
+	if ls.Value != nil {
+		val = e.Eval(ls.Value, env)
+	}
 	if isError(val) {
 		return val
 	}
+
+	if ls.Pattern != nil {
+		return destructure(ls.Pattern, val, env)
+	}
 	env.Set(ls.Name.Value, val)
 
 	return val
 }
 
-func evalIdentifier(ie *ast.Identifier, env *object.Environment) object.Object {
+func destructure(pattern ast.Pattern, val object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return newError(object.TYPE_ERROR, "cannot destructure %s as an array", val.Type())
+		}
+		if len(array.Elements) < len(pattern.Elements) {
+			return newError(object.VALUE_ERROR, "cannot destructure array of length %d into %d names", len(array.Elements), len(pattern.Elements))
+		}
+
+		for i, name := range pattern.Elements {
+			env.Set(name.Value, array.Elements[i])
+		}
+
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError(object.TYPE_ERROR, "cannot destructure %s as a hash", val.Type())
+		}
+
+		for _, key := range pattern.Keys {
+			pair, ok := hash.Get(&object.String{Value: key.Value})
+			if !ok {
+				return newError(object.INDEX_ERROR, "cannot destructure missing key: %s", key.Value)
+			}
+			env.Set(key.Value, pair.Value)
+		}
+	}
+
+	return val
+}
+
+func (e *Evaluator) evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	val := e.Eval(ae.Value, env)
+	if isError(val) {
+		return val
+	}
+	if !env.Assign(ae.Name.Value, val) {
+		return newError(object.NAME_ERROR, "cannot assign to undeclared identifier: %s", ae.Name.Value)
+	}
+
+	return val
+}
+
+func (e *Evaluator) evalIdentifier(ie *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(ie.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[ie.Value]; ok {
+	if builtin, ok := e.builtins.Lookup(ie.Value); ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + ie.Value)
+	return newError(object.NAME_ERROR, "identifier not found: "+ie.Value)
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+// evaluates expressions in order, stopping at the first error
+func (e *Evaluator) evalExpressions(expressions []ast.Expression, env *object.Environment) ([]object.Object, *object.Error) {
 	results := []object.Object{}
 
 	for _, exp := range expressions {
-		result := Eval(exp, env)
-		if isError(result) {
-			return []object.Object{result}
+		values, err := e.evalExpression(exp, env)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, values...)
+	}
+
+	return results, nil
+}
+
+// like evalExpressions, but errors tell which argument of the call to function they came out of
+func (e *Evaluator) evalArguments(function ast.Expression, parameters []ast.Expression, env *object.Environment) ([]object.Object, *object.Error) {
+	args := []object.Object{}
+
+	for i, param := range parameters {
+		values, err := e.evalExpression(param, env)
+		if err != nil {
+			pos := param.Pos()
+			err.Trace = append(err.Trace, object.Frame{Function: calleeName(function), Argument: i + 1, Line: pos.Line, Column: pos.Column})
+			return nil, err
 		}
-		results = append(results, result)
+		args = append(args, values...)
 	}
 
-	return results
+	return args, nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// a spread expression evaluates to the elements of its array, anything else to a single value
+func (e *Evaluator) evalExpression(exp ast.Expression, env *object.Environment) ([]object.Object, *object.Error) {
+	spread, ok := exp.(*ast.SpreadExpression)
+	if !ok {
+		result := e.Eval(exp, env)
+		if err, ok := result.(*object.Error); ok {
+			return nil, err
+		}
+		return []object.Object{result}, nil
+	}
+
+	result := e.Eval(spread.Value, env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	array, ok := result.(*object.Array)
+	if !ok {
+		err := newError(object.TYPE_ERROR, "cannot spread %s", result.Type())
+		locateError(err, spread)
+		return nil, err
+	}
+	return array.Elements, nil
+}
+
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		closure := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, closure)
-		return unwrapReturnValue(evaluated)
+		if !fn.Generator {
+			defer e.depth.Add(-1)
+			if e.depth.Add(1) > e.maxDepth {
+				return newError(object.RUNTIME_ERROR, "maximum recursion depth exceeded")
+			}
+		}
+
+		for {
+			if err := e.cancelled(); err != nil {
+				return err
+			}
+			if err := checkArity(fn, args); err != nil {
+				return err
+			}
+			if fn.Generator {
+				return e.newGenerator(fn, args)
+			}
+
+			closure := extendFunctionEnv(fn, args)
+			evaluated := unwrapReturnValue(e.Eval(fn.Body, closure))
+
+			tailCall, ok := evaluated.(*object.TailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args = tailCall.Function, tailCall.Arguments
+		}
 	case *object.Builtin:
-		return fn.Fn(args...)
+		// builtins like map call back into the evaluator, in this call chain
+		if newBuiltin, ok := e.evaluatorBuiltins[fn]; ok && e.spawned {
+			fn = newBuiltin(e)
+		}
+		// builtins like push and split make new values
+		return e.allocateBuiltin(fn, args, fn.Fn(args...))
 	default:
-		return newError("not a function: %T", fn)
+		return newError(object.TYPE_ERROR, "not a function: %T", fn)
 	}
 
 }
 
+// the one place to account for parameters that can be left out, once there are any
+func checkArity(fn *object.Function, args []object.Object) *object.Error {
+	if len(args) != len(fn.Parameters) {
+		return newError(object.ARITY_ERROR, "wrong number of arguments. expected=%d got=%d", len(fn.Parameters), len(args))
+	}
+	return nil
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
@@ -393,9 +1590,13 @@ func extendFunctionEnv(
 // Prevents a value returned from a function from short-circuiting
 // parent blocks
 func unwrapReturnValue(obj object.Object) object.Object {
-	rtnVal, ok := obj.(*object.ReturnValue)
-	if !ok {
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		// loops can't be controlled from inside a called function
+		return newError(object.RUNTIME_ERROR, "%s outside of a loop", obj.Inspect())
+	default:
 		return obj
 	}
-	return rtnVal.Value
 }
@@ -1,12 +1,19 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -37,6 +44,116 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestCheckedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "integer overflow"},
+		{"-9223372036854775807 - 2", "integer overflow"},
+		{"4611686018427387904 * 2", "integer overflow"},
+		{"-(-9223372036854775807 - 1)", "integer overflow"},
+		{"let x = 9223372036854775807; x += 1", "integer overflow"},
+		{"9223372036854775807 - 1", 9223372036854775806},
+		{"-9223372036854775807 - 1 < 0", true},
+		{"try { 9223372036854775807 * 2 } catch (e) { e.kind }", "ValueError"},
+		{"9223372036854775807 * 2.0 > 0", true},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithCheckedIntegers()).Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, str.Value)
+				}
+				continue
+			}
+			testError(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"10.0 - 2 * 1.5", 7},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		testFloatObject(t, result, tt.expected)
+	}
+
+	testBooleanObject(t, testEval("1.5 > 1"), true)
+	testBooleanObject(t, testEval("2 == 2.0"), true)
+	testBooleanObject(t, testEval("0.1 < 0.01"), false)
+
+	if inspected := testEval("4.0").Inspect(); inspected != "4.0" {
+		t.Errorf("Unexpected float inspect. expected=%q got=%q", "4.0", inspected)
+	}
+}
+
+func TestBigIntPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)", "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		bigInt, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("evaluated object is not an object.BigInt. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if bigInt.Inspect() != tt.expected {
+			t.Errorf("Unexpected evaluated value. expected=%s got=%s", tt.expected, bigInt.Inspect())
+		}
+	}
+
+	// results that fit in an int64 again are plain integers
+	testIntegerObject(t, testEval("9223372036854775807 + 1 - 2"), 9223372036854775806)
+	testIntegerObject(t, testEval("4294967296 * 4294967296 / 4294967296"), 4294967296)
+	testBooleanObject(t, testEval("9223372036854775807 + 1 > 9223372036854775807"), true)
+	testFloatObject(t, testEval("(9223372036854775807 + 1) * 0.5"), 4611686018427387904)
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+
+	if !ok {
+		t.Errorf("evaluated object is not an object.Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("Unexpected evaluated value. expected=%f got=%f", expected, result.Value)
+		return false
+	}
+	return true
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -81,6 +198,25 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1.5 <= 1", false},
+		{`"a" <= "b"`, true},
+		{`"b" <= "b"`, true},
+		{`"a" >= "b"`, false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" > "abd"`, false},
+		{`"b" > "abc"`, true},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`let s = "x"; s + "y" == "xy"`, true},
 	}
 
 	for _, tt := range tests {
@@ -103,6 +239,30 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"1 < 2 && 2 < 3", true},
+		{"let x = 0; x != 0 && 10 / x > 2", false},
+		{"let x = 0; x == 0 || 10 / x > 2", true},
+		{"let x = 0; let set = fn() { x = 1 }; false && set(); x == 0", true},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		testBooleanObject(t, result, tt.expected)
+	}
+
+	testError(t, testEval("true && -true"), "unkown operator: -BOOLEAN")
+}
+
 func TestEvalBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -158,6 +318,35 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { i += 1 }; i", 5},
+		{"let i = 0; while (i < 5) { i += 1 }", nil},
+		{"let i = 0; while (true) { i += 1; if (i == 3) { break; } }; i", 3},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; if (i == 2) { continue; } sum += i }; sum", 13},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i > 4) { return i; } } }; f()", 5},
+		{"let i = 0; while (i < 3) { let j = 0; while (true) { break; }; i += 1 }; i", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	testError(t, testEval("break;"), "break outside of a loop")
+	testError(t, testEval("if (true) { continue; }"), "continue outside of a loop")
+	testError(t, testEval("let f = fn() { break; }; while (true) { f() }"), "break outside of a loop")
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -212,6 +401,14 @@ func TestErrorHandling(t *testing.T) {
 			`"Hello" - "World"`,
 			"unkown operator: STRING - STRING",
 		},
+		{"1 / 0", "division by zero"},
+		{"let x = 0; 10 / x", "division by zero"},
+		{"(9223372036854775807 + 1) / 0", "division by zero"},
+		{"(9223372036854775807 + 1) / (1 - 1)", "division by zero"},
+		{"fn(x, y) { x }(1)", "wrong number of arguments. expected=2 got=1"},
+		{"let f = fn() { 1 }; f(1)", "wrong number of arguments. expected=0 got=1"},
+		{"fn f(x) { f() }; f(1)", "wrong number of arguments. expected=1 got=0"},
+		{"map([1], fn(x, y) { x })", "wrong number of arguments. expected=2 got=1"},
 	}
 
 	for _, tt := range tests {
@@ -229,6 +426,99 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom"; 1 } catch (e) { e }`, "boom"},
+		{`try { throw {"code": 42} } catch (e) { e["code"] }`, 42},
+		{`try { 1 + true } catch (e) { e.message }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { [1][5] } catch (e) { e.kind }`, "IndexError"},
+		{`try { 1 / 0 } catch (e) { e.kind }`, "ValueError"},
+		{`try { len() } catch (e) { e.kind == "ArityError" }`, true},
+		{"let x = 1;\ntry {\n  x + nope\n} catch (e) { [e.kind, e.line, e.column] }", []interface{}{"NameError", 3, 7}},
+		{`let f = fn() { throw 7 }; try { f(); 1 } catch (e) { e + 1 }`, 8},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`, 2},
+		{`let f = fn() { try { return 3 } catch (e) { 4 }; 5 }; f()`, 3},
+		{`try { throw 1 } catch (e) { 2 }; e`, "Err: identifier not found: e"},
+		{`throw "uncaught"; 1`, "Err: uncaught"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input   string
+		kind    object.ErrorKind
+		line    int
+		column  int
+		inspect string
+	}{
+		{`1 + true`, object.TYPE_ERROR, 1, 3, "TypeError at 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let a = [1];\na[3]", object.INDEX_ERROR, 2, 2, "IndexError at 2:2: Index is larger than the max. index=3, max=0"},
+		{`len(1, 2)`, object.ARITY_ERROR, 1, 4, "ArityError at 1:4: wrong number of arguments. expected=1 got=2"},
+		{"let f = fn() {\n  missing\n};\nf()", object.NAME_ERROR, 2, 3, "NameError at 2:3: identifier not found: missing"},
+		{`int("x")`, object.VALUE_ERROR, 1, 4, "ValueError at 1:4: cannot convert \"x\" to INTEGER"},
+		{`floor(1.0 / 0.0)`, object.VALUE_ERROR, 1, 6, "ValueError at 1:6: cannot convert +Inf to INTEGER"},
+		{"1;\nbreak", object.RUNTIME_ERROR, 2, 1, "RuntimeError at 2:1: break outside of a loop"},
+		{`{nope: 1}`, object.NAME_ERROR, 1, 2, "NameError at 1:2: identifier not found: nope"},
+		{`{"a": 1, "b": 1 + true}`, object.TYPE_ERROR, 1, 17, "TypeError at 1:17: type mismatch: INTEGER + BOOLEAN"},
+		{`{"a": 1, [1]: 2}`, object.TYPE_ERROR, 1, 10, "TypeError at 1:10: Cannot use as key ARRAY"},
+		{`  throw "up"`, object.THROWN_ERROR, 1, 3, "ThrownError at 1:3: up"},
+	}
+
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if err.Kind != tt.kind {
+			t.Errorf("wrong kind for %q. expected=%s got=%s", tt.input, tt.kind, err.Kind)
+		}
+		if err.Line != tt.line || err.Column != tt.column {
+			t.Errorf("wrong position for %q. expected=%d:%d got=%d:%d", tt.input, tt.line, tt.column, err.Line, err.Column)
+		}
+		if err.Inspect() != tt.inspect {
+			t.Errorf("wrong inspection for %q. expected=%q got=%q", tt.input, tt.inspect, err.Inspect())
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input     string
+		traceback string
+	}{
+		{`1 + true`, "TypeError at 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"fn inner(x) {\n  x + true\n}\nfn outer() {\n  let y = inner(1);\n  y\n}\nouter()",
+			"TypeError at 2:5: type mismatch: INTEGER + BOOLEAN\n  in inner called at 5:16\n  in outer called at 8:6"},
+		{`let h = {"f": fn() { len(1) }}; h.f()`,
+			"TypeError at 1:25: argument to `len` not supported, got INTEGER\n  in f called at 1:36"},
+		{`fn() { throw "up" }()`, "ThrownError at 1:8: up\n  in fn called at 1:20"},
+		{`let make = fn() { fn() { nope } }; make()()`, "NameError at 1:26: identifier not found: nope\n  in make() called at 1:42"},
+		{`fn f(a, b) { a }; f(1, nope)`, "NameError at 1:24: identifier not found: nope\n  in argument 2 of f at 1:24"},
+		{`puts(len(1, 2 + true))`, "TypeError at 1:15: type mismatch: INTEGER + BOOLEAN\n  in argument 2 of len at 1:13\n  in argument 1 of puts at 1:6"},
+		{`[1].push(...2)`, "TypeError at 1:10: cannot spread INTEGER\n  in argument 1 of push at 1:10"},
+	}
+
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if err.Traceback() != tt.traceback {
+			t.Errorf("wrong traceback for %q.\nexpected=%q\ngot=     %q", tt.input, tt.traceback, err.Traceback())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -238,11 +528,76 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a", 25},
 		{"let a = 6; let b = a; b", 6},
 		{"let a = 7; let b = a + 1; let c = 2 * a + b; c", 22},
+		{"let café = 5; let 名前 = café * 2; 名前", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLetWithoutValue(t *testing.T) {
+	testNullObject(t, testEval("let x; x"))
+	testIntegerObject(t, testEval("let x; x = 5; x"), 5)
+	testIntegerObject(t, testEval("let x; if (is_null(x)) { 1 } else { 2 }"), 1)
+}
+
+func TestLetArrayDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [a, b, c] = [1, 2, 3]; a + b + c", 6},
+		{"let [a] = [4, 5, 6]; a", 4},
+		{"let pair = fn() { [7, 8] }; let [x, y] = pair(); y - x", 1},
+		{"let [] = []; 9", 9},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testError(t, testEval("let [a, b, c] = [1, 2]; a"), "cannot destructure array of length 2 into 3 names")
+	testError(t, testEval("let [a] = 1; a"), "cannot destructure INTEGER as an array")
+}
+
+func TestLetHashDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let {name, age} = {"name": "Alice", "age": 30}; age`, 30},
+		{`let {name, age} = {"name": "Alice", "age": 30}; name`, "Alice"},
+		{`let {a} = {"a": 1, "b": 2, 3: 4}; a`, 1},
+		{`let {name, age} = {"name": "Alice"}; age`, "Err: cannot destructure missing key: age"},
+		{`let {a} = [1]; a`, "Err: cannot destructure ARRAY as a hash"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a = 6; a", 6},
+		{"let a = 5; a = a + 1", 6},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let count = 0; let inc = fn() { count = count + 1 }; inc(); inc(); count", 2},
+		{"let a = 1; let shadow = fn(a) { a = 10; a }; shadow(2) + a", 11},
+		{"let a = 5; a += 2; a", 7},
+		{"let a = 5; a -= 2; a *= 3; a", 9},
+		{"let a = 10; let halve = fn() { a /= 2 }; halve(); a", 5},
 	}
 
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
+
+	testError(t, testEval("b = 5"), "cannot assign to undeclared identifier: b")
 }
 
 func TestFunctionObject(t *testing.T) {
@@ -286,118 +641,1091 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
-func TestStringLiteral(t *testing.T) {
-	input := `"Hello, world!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not a string, got=%T (%+v)", evaluated, evaluated)
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(1000000)`, 0},
+		{`fn sum(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); } sum(100000, 0)`, 5000050000},
+		{`fn even(n) { if (n == 0) { true } else { odd(n - 1) } }
+		  fn odd(n) { if (n == 0) { false } else { even(n - 1) } }
+		  if (even(100001)) { 1 } else { 2 }`, 2},
+		{`fn fail() { throw "boom" } fn f() { try { fail() } catch (e) { e } } f()`, "boom"},
+		{`fn f(n) { while (true) { return n |> g } } fn g(n) { n + 1 } f(1)`, 2},
 	}
 
-	if str.Value != "Hello, world!" {
-		t.Errorf("String has the wrong value. expected=%q got=%q", "Hello, world!", str.Value)
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
 	}
 }
 
-func TestStringConcatination(t *testing.T) {
-	input := `"Hello" + ", " + "world!"`
-
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not a string, got=%T (%+v)", evaluated, evaluated)
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`fn count(n) { let i = 0; while (i < n) { yield i; i += 1 } }
+		  let g = count(3); [next(g), next(g), next(g)]`, []interface{}{0, 1, 2}},
+		{`fn nat() { let i = 0; while (true) { yield i; i += 1 } }
+		  let g = nat(); next(g); next(g); next(g)`, 2},
+		{`let n = 0; fn g() { n = 1; yield 2 } let gen = g(); n`, 0},
+		{`let pairs = fn() { yield "a"; try { 1 + true } catch (e) { yield e.message } }; let g = pairs(); next(g); next(g)`,
+			"type mismatch: INTEGER + BOOLEAN"},
+		{`fn bad() { yield 1; 1 + true } let g = bad(); next(g); next(g)`, "Err: type mismatch: INTEGER + BOOLEAN"},
+		{`yield 1`, "Err: yield outside of a generator"},
+		// closures made in the body can't yield once they've escaped it
+		{`let leak = 0; fn g() { leak = delay(yield 1); yield 2 } let it = g(); next(it); next(it); next(it); force(leak)`,
+			"Err: yield outside of a running generator"},
+		{`let leak = 0; fn g() { leak = delay(yield 1); yield 2 } let it = g(); next(it); force(leak)`,
+			"Err: yield outside of a running generator"},
+		{`fn g() { let t = delay(yield 1); force(t); yield 2 } let it = g(); [next(it), next(it)]`, []interface{}{1, 2}},
+		{`next(1)`, "Err: argument to `next` not supported, got INTEGER"},
 	}
 
-	if str.Value != "Hello, world!" {
-		t.Errorf("String has the wrong value. expected=%q got=%q", "Hello, world!", str.Value)
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
 	}
+
+	testNullObject(t, testEval(`fn one() { yield 1 } let g = one(); next(g); next(g)`))
+	testNullObject(t, testEval(`fn bad() { 1 + true; yield 1 } let g = bad(); try { next(g) } catch (e) { 0 }; next(g)`))
 }
 
-func TestBuiltinFunctions(t *testing.T) {
+func TestSpawn(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{`len("")`, 0},
-		{`len("barr")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "Err: argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "Err: wrong number of arguments. expected=1 got=2"},
-		{`len(["one", "two"])`, 2},
-		{`len([1, "two", fn(){ 2 }])`, 3},
-		{`first([1, "two"])`, 1},
-		{`first([3])`, 3},
-		{`first([])`, nil},
-		{`first([fn(){ 8 }])()`, 8},
-		{`rest([4, 5, 6, 7])`, []interface{}{5, 6, 7}},
-		{`rest([1, "two", 3, fn(){return 4}()])`, []interface{}{"two", 3, 4}},
-		{`rest([1])`, nil},
-		{`rest([])`, nil},
-		{`push([1, 2], 3)`, []interface{}{1, 2, 3}},
-		{`push([4], fn(){5}())`, []interface{}{4, 5}},
+		{`let h = spawn fn(x) { x * 2 }(21); wait(h)`, 42},
+		{`let h = spawn fn(x) { x * 2 }(21); wait(h) + wait(h)`, 84},
+		{`fn sum(n) { let i = 0; let s = 0; while (i < n) { s += i; i += 1 }; s }
+		  let handles = [spawn sum(10), spawn sum(100), spawn sum(1000)];
+		  wait(handles[0]) + wait(handles[1]) + wait(handles[2])`, 504495},
+		{`let total = 0; fn add(n) { total += n } wait(spawn add(5)); total`, 5},
+		{`wait(spawn [1, 2].len())`, 2},
+		{`wait(spawn fn() { 1 + true }())`, "Err: type mismatch: INTEGER + BOOLEAN"},
+		{`spawn nope()`, "Err: identifier not found: nope"},
+		{`wait(1)`, "Err: argument to `wait` not supported, got INTEGER"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testObject(t, evaluated, tt.expected)
+		testObject(t, testEval(tt.input), tt.expected)
 	}
 }
 
-func testObject(t *testing.T, evaluated object.Object, expected interface{}) {
-	switch expected := expected.(type) {
-	case int:
-		testIntegerObject(t, evaluated, int64(expected))
-	case string:
-		if strings.Contains(expected, "Err: ") {
-			expectedMessage := strings.TrimLeft(expected, "Err: ")
-			testError(t, evaluated, expectedMessage)
-			return
-		}
-
-		err, ok := evaluated.(*object.String)
-		if !ok {
-			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
-		}
-		if err.Value != expected {
-			t.Errorf("wrong string value. expected=%q, got=%q", expected, err.Value)
-		}
-	case []interface{}:
-		ar, ok := evaluated.(*object.Array)
-		if !ok {
-			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
-		}
-		if len(expected) != len(ar.Elements) {
-			t.Errorf("wrong number of elements. expected=%d got=%d", len(expected), len(ar.Elements))
-		}
-
-		for i, el := range ar.Elements {
-			testObject(t, el, expected[i])
-		}
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let c = chan(); spawn send(c, 42); recv(c)`, 42},
+		{`let c = chan(2); send(c, 1); send(c, 2); recv(c) + recv(c)`, 3},
+		{`fn produce(c, n) { let i = 1; while (i <= n) { send(c, i); i += 1 }; close(c) }
+		  let c = chan(); spawn produce(c, 10);
+		  let total = 0; let v = recv(c); while (v) { total += v; v = recv(c) }; total`, 55},
+		{`let a = chan(); let b = chan(1); send(b, "b"); recv_any([a, b])`, []interface{}{1, "b"}},
+		{`let a = chan(); let b = chan(); close(a); spawn send(b, 7); recv_any([a, b])`, []interface{}{1, 7}},
+		{`let c = chan(); close(c); send(c, 1)`, "Err: send on closed channel"},
+		{`let c = chan(); close(c); close(c)`, "Err: close of closed channel"},
+		{`chan(-1)`, "Err: argument to `chan` must be a non-negative INTEGER, got -1"},
+		{`recv_any([1])`, "Err: argument to `recv_any` must only contain channels, got INTEGER"},
 	}
-}
 
-func testError(t *testing.T, evaluated object.Object, expectedMessage string) {
-	err, ok := evaluated.(*object.Error)
-	if !ok {
-		t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
-	}
-	if err.Message != expectedMessage {
-		t.Errorf("wrong error message. expected=%s, got=%s", expectedMessage, err.Message)
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
 	}
-	return
+
+	testNullObject(t, testEval(`let c = chan(); close(c); recv(c)`))
+	testNullObject(t, testEval(`let a = chan(); close(a); recv_any([a])`))
 }
 
-func TestArray(t *testing.T) {
+func TestSets(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected []interface{}
+		expected interface{}
 	}{
-		{`[1,"string"];`, []interface{}{1, "string"}},
+		{`len(set([1, 2, 2, 3, 1]))`, 3},
+		{`len(set())`, 0},
+		{`let s = set([1]); let t = add(s, 2, "a", 2); [len(s), len(t)]`, []interface{}{1, 3}},
+		{`union(set([1, 2]), set([2, 3])).len()`, 3},
+		{`len(intersect(set([1, 2, 3]), set([3, 2, 5])))`, 2},
+		{`set([[1]])`, "Err: argument to `set` not supported, ARRAY is not hashable"},
+		{`union(set(), [1])`, "Err: argument to `union` not supported, got ARRAY"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`has(set(["a", "b"]), "a")`), true)
+	testBooleanObject(t, testEval(`has(set(["a", "b"]), "c")`), false)
+	testBooleanObject(t, testEval(`has(set(["a", "b"]), [1])`), false)
+	testBooleanObject(t, testEval(`let i = intersect(set([1, 2, 3]), set([3, 2, 5])); has(i, 2) && !has(i, 1)`), true)
+
+	inspected := testEval(`add(set([3, 1]), 2, 1)`).Inspect()
+	if inspected != "set([3, 1, 2])" {
+		t.Errorf("Unexpected set inspection. got=%q", inspected)
+	}
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`find_all("a1 b22 c333", regex("[0-9]+"))`, []interface{}{"1", "22", "333"}},
+		{`"none here".find_all(regex("[0-9]"))`, []interface{}{}},
+		{`replace("2024-01-15", regex("(\d+)-(\d+)-(\d+)"), "$3/$2/$1")`, "15/01/2024"},
+		{`let ws = regex("\s+"); "a  b  c".replace(ws, " ")`, "a b c"},
+		{`regex("(")`, "Err: invalid regex: error parsing regexp: missing closing ): `(`"},
+		{`match("abc", "b")`, "Err: argument to `match` must be a REGEX, got STRING"},
+		{`match(1, regex("b"))`, "Err: argument to `match` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`match("hello world", regex("wor"))`), true)
+	testBooleanObject(t, testEval(`"hello".match(regex("^w"))`), false)
+
+	inspected := testEval(`regex("a+b")`).Inspect()
+	if inspected != `regex("a+b")` {
+		t.Errorf("Unexpected regex inspection. got=%q", inspected)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`enum Color { Red, Green, Blue } let names = {Color.Red: "red", Color.Blue: "blue"}; names[Color.Blue]`, "blue"},
+		{`enum Color { Red, Green } let c = Color.Green; if (c == Color.Green) { 1 } else { 2 }`, 1},
+		{`enum Color { Red, Green } if (Color.Red != Color.Green) { 1 } else { 2 }`, 1},
+		{`enum Color { Red } Color.Purple`, "Err: enum Color has no variant Purple"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	inspected := []string{
+		testEval(`enum Color { Red, Green } Color`).Inspect(),
+		testEval(`enum Color { Red, Green } Color.Green`).Inspect(),
+	}
+	expected := []string{"enum Color { Red, Green }", "Color.Green"}
+	for i := range expected {
+		if inspected[i] != expected[i] {
+			t.Errorf("Unexpected enum inspection. expected=%q got=%q", expected[i], inspected[i])
+		}
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn add(x, y) { x + y }; add(2, 3)", 5},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"let outer = fn() { fn inner(n) { if (n == 0) { 0 } else { inner(n - 1) } }; inner(3) }; outer()", 0},
+		{"fn isEven(n) { if (n == 0) { 1 } else { isOdd(n - 1) } }; fn isOdd(n) { if (n == 0) { 0 } else { isEven(n - 1) } }; isEven(10)", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello, world!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not a string, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello, world!" {
+		t.Errorf("String has the wrong value. expected=%q got=%q", "Hello, world!", str.Value)
+	}
+}
+
+func TestRawStringLiteral(t *testing.T) {
+	input := "let s = `a\\n\n\"b\"`; s + `!`"
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not a string, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := "a\\n\n\"b\"!"
+	if str.Value != expected {
+		t.Errorf("String has the wrong value. expected=%q got=%q", expected, str.Value)
+	}
+}
+
+func TestStringConcatination(t *testing.T) {
+	input := `"Hello" + ", " + "world!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not a string, got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello, world!" {
+		t.Errorf("String has the wrong value. expected=%q got=%q", "Hello, world!", str.Value)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("barr")`, 4},
+		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`len(1)`, "Err: argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "Err: wrong number of arguments. expected=1 got=2"},
+		{`len(["one", "two"])`, 2},
+		{`len([1, "two", fn(){ 2 }])`, 3},
+		{`first([1, "two"])`, 1},
+		{`first([3])`, 3},
+		{`first([])`, nil},
+		{`first([fn(){ 8 }])()`, 8},
+		{`rest([4, 5, 6, 7])`, []interface{}{5, 6, 7}},
+		{`rest([1, "two", 3, fn(){return 4}()])`, []interface{}{"two", 3, 4}},
+		{`rest([1])`, nil},
+		{`rest([])`, nil},
+		{`push([1, 2], 3)`, []interface{}{1, 2, 3}},
+		{`push([4], fn(){5}())`, []interface{}{4, 5}},
+		{`let a = push([], 1); let b = push(a, 2); let c = push(b, 3); let d = push(b, 4); [a, b, c, d]`,
+			[]interface{}{[]interface{}{1}, []interface{}{1, 2}, []interface{}{1, 2, 3}, []interface{}{1, 2, 4}}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func testObject(t *testing.T, evaluated object.Object, expected interface{}) {
+	switch expected := expected.(type) {
+	case nil:
+		testNullObject(t, evaluated)
+	case int:
+		testIntegerObject(t, evaluated, int64(expected))
+	case bool:
+		testBooleanObject(t, evaluated, expected)
+	case string:
+		if strings.Contains(expected, "Err: ") {
+			expectedMessage := strings.TrimLeft(expected, "Err: ")
+			testError(t, evaluated, expectedMessage)
+			return
+		}
+
+		err, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if err.Value != expected {
+			t.Errorf("wrong string value. expected=%q, got=%q", expected, err.Value)
+		}
+	case []interface{}:
+		ar, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+		if len(expected) != len(ar.Elements) {
+			t.Errorf("wrong number of elements. expected=%d got=%d", len(expected), len(ar.Elements))
+		}
+
+		for i, el := range ar.Elements {
+			testObject(t, el, expected[i])
+		}
+	}
+}
+
+func testError(t *testing.T, evaluated object.Object, expectedMessage string) {
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if err.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%s, got=%s", expectedMessage, err.Message)
+	}
+	return
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`abs(-5)`, 5},
+		{`abs(5)`, 5},
+		{`min(3, 1, 2)`, 1},
+		{`max(3, 1, 2)`, 3},
+		{`max(7)`, 7},
+		{`max(2.5, 3)`, 3},
+		{`[4, 9, 2] |> reduce(0, max)`, 9},
+		{`pow(2, 10)`, 1024},
+		{`pow(-3, 3)`, -27},
+		{`pow(2, 64) / pow(2, 60)`, 16},
+		{`floor(2.7)`, 2},
+		{`floor(-2.5)`, -3},
+		{`ceil(2.1)`, 3},
+		{`ceil(4)`, 4},
+		{`floor(sqrt(-1.0))`, "Err: cannot convert NaN to INTEGER"},
+		{`ceil(pow(10.0, 400))`, "Err: cannot convert +Inf to INTEGER"},
+		{`min()`, "Err: wrong number of arguments. expected at least 1 got=0"},
+		{`max(1, "2")`, "Err: argument to `max` not supported, got STRING"},
+		{`abs("1")`, "Err: argument to `abs` not supported, got STRING"},
+		{`pow(2)`, "Err: wrong number of arguments. expected=2 got=1"},
+		{`sqrt([])`, "Err: argument to `sqrt` not supported, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{`abs(-1.5)`, 1.5},
+		{`min(2, 1.5)`, 1.5},
+		{`sqrt(16)`, 4},
+		{`sqrt(2.25)`, 1.5},
+		{`pow(2, -1)`, 0.5},
+		{`pow(4, 0.5)`, 2},
+	}
+
+	for _, tt := range floats {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`keys({"a": 1})`, []interface{}{"a"}},
+		{`values({"a": 1})`, []interface{}{1}},
+		{`keys({})`, []interface{}{}},
+		{`entries({})`, []interface{}{}},
+		{`len(keys({1: 1, 2: 2, 3: 3}))`, 3},
+		{`reduce(values({"a": 1, "b": 2, "c": 3}), 0, fn(acc, x) { acc + x })`, 6},
+		{`let h = {"one": 1, "two": 2}; reduce(keys(h), 0, fn(acc, k) { acc + h[k] })`, 3},
+		{`entries({"k": "v"})[0]`, []interface{}{"k", "v"}},
+		{`keys([1])`, "Err: argument to `keys` not supported, got ARRAY"},
+		{`values({}, {})`, "Err: wrong number of arguments. expected=1 got=2"},
+		{`keys(put(put(put({}, "c", 1), "a", 2), "b", 3))`, []interface{}{"c", "a", "b"}},
+		{`values(put(put({}, 1, "x"), 1, "y"))`, []interface{}{"y"}},
+		{`entries(delete(put(put(put({}, "a", 1), "b", 2), "c", 3), "b"))`, []interface{}{[]interface{}{"a", 1}, []interface{}{"c", 3}}},
+		{`str(merge(put(put({}, "x", 1), "y", 2), put(put({}, "z", 3), "x", 4)))`, "{x: 4, y: 2, z: 3}"},
+		{`put({}, "a", 1)["a"]`, 1},
+		{`get({"a": 1}, "a")`, 1},
+		{`get({"a": 1}, "b")`, nil},
+		{`get({"a": 1}, "b", 0)`, 0},
+		{`{}.get([1], "unhashable")`, "unhashable"},
+		{`get([], 1)`, "Err: argument to `get` not supported, got ARRAY"},
+		{`get({})`, "Err: wrong number of arguments. expected=2 or 3 got=1"},
+		{`put({"a": 1}, "a", 2)["a"]`, 2},
+		{`let h = {"a": 1}; let g = put(h, "b", 2); len(keys(h)) + len(keys(g))`, 3},
+		{`keys(delete({"a": 1, "b": 2}, "a"))`, []interface{}{"b"}},
+		{`let h = {"a": 1}; delete(h, "a"); h["a"]`, 1},
+		{`len(keys(delete({"a": 1}, "missing")))`, 1},
+		{`let m = merge({"a": 1, "b": 2}, {"b": 3, "c": 4}); [m["a"], m["b"], m["c"]]`, []interface{}{1, 3, 4}},
+		{`put({}, [1], 1)`, "Err: argument to `put` not supported, ARRAY is not hashable"},
+		{`merge({}, [])`, "Err: argument to `merge` not supported, got ARRAY"},
+		{`delete([1], 0)`, "Err: argument to `delete` not supported, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`has_key({"a": 1}, "a")`), true)
+	testBooleanObject(t, testEval(`{1: true}.has_key(2)`), false)
+	testBooleanObject(t, testEval(`has_key({}, [])`), false)
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type(9223372036854775807 + 1)`, "BIGINT"},
+		{`type("a")`, "STRING"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(fn() {})`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(first([]))`, "NULL"},
+		{`type(1, 2)`, "Err: wrong number of arguments. expected=1 got=2"},
+		{`is_int()`, "Err: wrong number of arguments. expected=1 got=0"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	predicates := []struct {
+		input    string
+		expected bool
+	}{
+		{`is_int(1)`, true},
+		{`is_int(9223372036854775807 * 2)`, true},
+		{`is_int(1.5)`, false},
+		{`is_int("1")`, false},
+		{`is_string("1")`, true},
+		{`is_array([1])`, true},
+		{`is_array({})`, false},
+		{`is_hash({})`, true},
+		{`is_fn(fn(x) { x })`, true},
+		{`is_fn(len)`, true},
+		{`is_fn(1)`, false},
+		{`is_null(first([]))`, true},
+		{`is_null(false)`, false},
+		{`let x = 5; if (is_int(x)) { true } else { x + "!" }`, true},
+	}
+
+	for _, tt := range predicates {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`int("42")`, 42},
+		{`int(" -7 ")`, -7},
+		{`int(3.9)`, 3},
+		{`int(-3.9)`, -3},
+		{`int(true)`, 1},
+		{`int(5)`, 5},
+		{`int("4" + "2") + 1`, 43},
+		{`int("abc")`, "Err: cannot convert \"abc\" to INTEGER"},
+		{`int("1.5")`, "Err: cannot convert \"1.5\" to INTEGER"},
+		{`int([])`, "Err: argument to `int` not supported, got ARRAY"},
+		{`str(42)`, "42"},
+		{`str("a")`, "a"},
+		{`str([1, "b"])`, "[1, b]"},
+		{`str(true) + "!"`, "true!"},
+		{`bool("yes")`, "Err: cannot convert \"yes\" to BOOLEAN"},
+		{`bool(fn() {})`, "Err: argument to `bool` not supported, got FUNCTION"},
+		{`str()`, "Err: wrong number of arguments. expected=1 got=0"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	if big, ok := testEval(`int("123456789012345678901234567890")`).(*object.BigInt); !ok || big.Value.String() != "123456789012345678901234567890" {
+		t.Errorf("int() should promote large numbers to a BigInt")
+	}
+
+	booleans := []struct {
+		input    string
+		expected bool
+	}{
+		{`bool(0)`, false},
+		{`bool(1)`, true},
+		{`bool(0.0)`, false},
+		{`bool("")`, false},
+		{`bool("true")`, true},
+		{`bool("false")`, false},
+		{`bool([])`, false},
+		{`bool([0])`, true},
+		{`bool({})`, false},
+		{`bool(first([]))`, false},
+		{`bool(false)`, false},
+	}
+
+	for _, tt := range booleans {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`split("a,b,c", ",")`, []interface{}{"a", "b", "c"}},
+		{`split("a,,b", ",")`, []interface{}{"a", "", "b"}},
+		{`split("日本", "")`, []interface{}{"日", "本"}},
+		{`split("abc", "-")`, []interface{}{"abc"}},
+		{`join(["a", "b"], "-")`, "a-b"},
+		{`join([], ", ")`, ""},
+		{`"1 2 3".split(" ").join("+")`, "1+2+3"},
+		{`split(1, ",")`, "Err: argument to `split` not supported, got INTEGER"},
+		{`split("a", 1)`, "Err: argument to `split` must be a STRING, got INTEGER"},
+		{`join(["a", 1], "")`, "Err: argument to `join` must only contain strings, got INTEGER"},
+		{`join("ab", "")`, "Err: argument to `join` not supported, got STRING"},
+		{`upper("héllo")`, "HÉLLO"},
+		{`lower("ÀB c")`, "àb c"},
+		{"trim(\"  \t spaced out \n\")", "spaced out"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`"aaa".replace("a", "$1")`, "$1$1$1"},
+		{`index_of("日本語", "語")`, 2},
+		{`index_of("hello", "l")`, 2},
+		{`index_of("hello", "z")`, -1},
+		{`upper(1)`, "Err: argument to `upper` not supported, got INTEGER"},
+		{`contains("a", 1)`, "Err: argument to `contains` must be a STRING, got INTEGER"},
+		{`trim("a", "b")`, "Err: wrong number of arguments. expected=1 got=2"},
+		{`format("x={} y={}", 1, "two")`, "x=1 y=two"},
+		{`format("{}", [1, {"a": true}][0:1])`, "[1]"},
+		{`format("no values")`, "no values"},
+		{`format("{{}} {}", "日本")`, "{} 日本"},
+		{`format("{} {}", 1)`, "Err: not enough values to `format`, got 1"},
+		{`format("{}", 1, 2)`, "Err: too many values to `format`, expected 1 got 2"},
+		{`format(1)`, "Err: argument to `format` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	predicates := []struct {
+		input    string
+		expected bool
+	}{
+		{`contains("日本語", "本")`, true},
+		{`contains("abc", "d")`, false},
+		{`starts_with("hello", "he")`, true},
+		{`"hello".starts_with("lo")`, false},
+		{`ends_with("hello", "lo")`, true},
+		{`ends_with("hello", "")`, true},
+	}
+
+	for _, tt := range predicates {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, [2, "three"]] == [1, [2, "three"]]`, true},
+		{`[1] == [1.0]`, true},
+		{`{"a": [1], "b": 2} == {"b": 2, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{} == {}`, true},
+		{`set([1, 2]) == set([2, 1])`, true},
+		{`set([1]) == set([1, 2])`, false},
+		{`[1] == {}`, false},
+		{`[true, first([])] == [true, first([])]`, true},
+		{`let f = fn() {}; [f] == [f]`, true},
+		{`[fn() {}] == [fn() {}]`, false},
+		{`eq([1, {"a": [2]}], [1, {"a": [2]}])`, true},
+		{`eq("a", "a")`, true},
+		{`eq(1, "1")`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`str(decimal("0.1") + decimal("0.2"))`, "0.3"},
+		{`decimal("0.1") + decimal("0.2") == decimal("0.3")`, true},
+		{`str(decimal("1.50") * 3)`, "4.5"},
+		{`str(10 - decimal("0.01"))`, "9.99"},
+		{`str(decimal(1) / 3)`, "0.3333333333333333"},
+		{`str(-decimal("2.5"))`, "-2.5"},
+		{`str(decimal(7))`, "7.0"},
+		{`str(decimal(0.1))`, "0.1"},
+		{`decimal("1.5") > 1`, true},
+		{`decimal("2") == 2`, true},
+		{`type(decimal("1"))`, "DECIMAL"},
+		{`int(decimal("-2.75"))`, -2},
+		{`bool(decimal("0.00"))`, false},
+		{`decimal("1") / 0`, "Err: division by zero"},
+		{`decimal("1") + 0.5`, "Err: type mismatch: DECIMAL + FLOAT"},
+		{`decimal("abc")`, "Err: cannot convert \"abc\" to DECIMAL"},
+		{`decimal("1/3")`, "Err: cannot convert \"1/3\" to DECIMAL"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`str(bytes("hé"))`, `b"h\xc3\xa9"`},
+		{`len(bytes("hé"))`, 3},
+		{`bytes("hé")[1]`, 195},
+		{`bytes("abc")[3]`, "Err: Index is larger than the max. index=3, max=2"},
+		{`to_string(bytes("hé")[2:])`, "Err: bytes are not valid UTF-8"},
+		{`to_string(bytes("héllo")[3:])`, "llo"},
+		{`to_string(bytes([104, 105]))`, "hi"},
+		{`bytes([256])`, "Err: cannot convert 256 to a byte"},
+		{`bytes("ab") == bytes([97, 98])`, true},
+		{`bytes("ab") == "ab"`, false},
+		{`to_string("ab")`, "Err: argument to `to_string` must be BYTES, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = freeze([1, 2]); a`, []interface{}{1, 2}},
+		{`is_frozen(freeze([1]))`, true},
+		{`is_frozen([1])`, false},
+		{`let h = freeze({"a": [1]}); is_frozen(h["a"])`, true},
+		{`let a = [[1]]; freeze(a); is_frozen(a[0])`, true},
+		{`push(freeze([1]), 2)`, "Err: argument to `push` is frozen"},
+		{`let a = [1]; freeze(a); push(a, 2)`, "Err: argument to `push` is frozen"},
+		{`let h = freeze({"a": [1]}); push(h["a"], 2)`, "Err: argument to `push` is frozen"},
+		{`put(freeze({}), "a", 1)`, "Err: argument to `put` is frozen"},
+		{`delete(freeze({"a": 1}), "a")`, "Err: argument to `delete` is frozen"},
+		{`merge(freeze({"a": 1}), {"b": 2})`, "Err: argument to `merge` is frozen"},
+		{`merge({"b": 2}, freeze({"a": 1}))["a"]`, 1},
+		// spawned calls may freeze and check the same value at once
+		{`let a = [[1]]; let hs = [spawn freeze(a), spawn is_frozen(a[0]), spawn freeze(a[0])]; wait(hs[0]); is_frozen(a[0])`, true},
+		{`is_frozen(concat(freeze([1]), [2]))`, false},
+		{`is_frozen(1)`, true},
+		{`freeze([1]) == [1]`, true},
+		{`freeze("a")`, "Err: argument to `freeze` not supported, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`reverse([1, 2, 3])`, []interface{}{3, 2, 1}},
+		{`reverse([])`, []interface{}{}},
+		{`let a = [1, 2]; reverse(a); a`, []interface{}{1, 2}},
+		{`concat([1], [2, 3], [])`, []interface{}{1, 2, 3}},
+		{`concat()`, []interface{}{}},
+		{`index_of([1, "two", 3], "two")`, 1},
+		{`index_of([1, 2], 3)`, -1},
+		{`slice([1, 2, 3, 4], 1, 3)`, []interface{}{2, 3}},
+		{`slice([1, 2, 3, 4], 2)`, []interface{}{3, 4}},
+		{`slice([1, 2], -5, 10)`, []interface{}{1, 2}},
+		{`slice([1, 2], 2, 1)`, []interface{}{}},
+		{`flatten([1, [2, 3], [], [[4]]])[0:3]`, []interface{}{1, 2, 3}},
+		{`len(flatten([[1], [[2]]]))`, 2},
+		{`zip([1, 2, 3], ["a", "b"])[1]`, []interface{}{2, "b"}},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`reverse("abc")`, "Err: argument to `reverse` not supported, got STRING"},
+		{`concat([1], 2)`, "Err: argument to `concat` not supported, got INTEGER"},
+		{`slice([1], "0")`, "Err: argument to `slice` must be an INTEGER, got STRING"},
+		{`zip([1], 1)`, "Err: argument to `zip` not supported, got INTEGER"},
+		{`contains(1, 1)`, "Err: argument to `contains` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`contains([1, 2, 3], 2)`), true)
+	testBooleanObject(t, testEval(`[1, 2, 3].contains("2")`), false)
+	testBooleanObject(t, testEval(`contains([true], true)`), true)
+	testBooleanObject(t, testEval(`contains([[1, 2]], [1, 2])`), true)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []interface{}{2, 4, 6}},
+		{`map([], fn(x) { x })`, []interface{}{}},
+		{`map(["a", "bc"], len)`, []interface{}{1, 2}},
+		{`let add = fn(a) { fn(b) { a + b } }; [1, 2].map(add(10))`, []interface{}{11, 12}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []interface{}{3, 4}},
+		{`[1, 2, 3] |> filter(fn(x) { false })`, []interface{}{}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`[1, 2, 3].map(fn(x) { x * x }).filter(fn(x) { x > 1 }).reduce(0, fn(a, b) { a + b })`, 13},
+		{`map([1, "a"], fn(x) { -x })`, "Err: unkown operator: -STRING"},
+		{`map(1, fn(x) { x })`, "Err: argument to `map` not supported, got INTEGER"},
+		{`filter([1], 2)`, "Err: argument to `filter` must be a FUNCTION, got INTEGER"},
+		{`reduce([1], fn(a, b) { a })`, "Err: wrong number of arguments. expected=3 got=2"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMemo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); fib(90)`, 2880067194370816120},
+		{`let calls = 0; let f = memo(fn(a, b) { calls += 1; a + b }); f(1, 2); f(1, 2); f(2, 1); calls`, 2},
+		{`let calls = 0; let f = memo(fn(s) { calls += 1; len(s) }); f("ab"); f("ab"); [f("ab"), calls]`, []interface{}{2, 1}},
+		{`let calls = 0; let f = memo(fn(x) { calls += 1 }); f([1]); f([1]); calls`, 2}, // arrays aren't hashable
+		{`let calls = 0; let f = memo(fn(x) { calls += 1; x }); f(1); f("1"); f(true); calls`, 3},
+		{`let f = memo(fn(x) { x + nope }); f(1)`, "Err: identifier not found: nope"},
+		{`memo(1)`, "Err: argument to `memo` must be a FUNCTION, got INTEGER"},
+		{`memo(len)("abc")`, 3},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// arguments with the same hash key aren't mixed up
+	memo, _ := New().Builtins().Lookup("memo")
+	identity := &object.Builtin{Fn: func(args ...object.Object) object.Object { return args[0] }}
+	f := memo.Fn(identity).(*object.Builtin)
+	a, b := &collidingKey{"a"}, &collidingKey{"b"}
+	if f.Fn(a) != a || f.Fn(b) != b || f.Fn(a) != a || f.Fn(b) != b {
+		t.Errorf("memo mixed up arguments with the same hash key")
+	}
+}
+
+// a hashable value whose hash key is the same for every value
+type collidingKey struct{ value string }
+
+func (c *collidingKey) Type() object.ObjectType { return "COLLIDING" }
+func (c *collidingKey) Inspect() string         { return c.value }
+func (c *collidingKey) HashKey() object.HashKey { return object.HashKey{Type: "COLLIDING"} }
+
+func TestStringBuilder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`str(string_builder())`, ""},
+		{`str(string_builder("a", 1, [true]))`, "a1[true]"},
+		{`let b = string_builder(); let i = 0; while (i < 3) { write(b, i, ","); i += 1 }; str(b)`, "0,1,2,"},
+		{`string_builder("x").write("y").write("z") |> str`, "xyz"},
+		{`type(string_builder())`, "STRING_BUILDER"},
+		{`write("a", "b")`, "Err: argument to `write` must be STRING_BUILDER, got STRING"},
+		{`write()`, "Err: wrong number of arguments. expected at least 1 got=0"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	program := parser.New(lexer.New(`let b = string_builder(); while (true) { write(b, "xxxx") }`)).ParseProgram()
+	testError(t, New(WithMaxAlloc(1000)).Eval(program, object.NewEnvironment()), "allocation limit of 1000 bytes exceeded")
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`rand_int(1)`, 0},
+		{`rand_int(0)`, "Err: argument to `rand_int` must be a positive INTEGER, got 0"},
+		{`rand_int("5")`, "Err: argument to `rand_int` must be a positive INTEGER, got 5"},
+		{`seed(1.5)`, "Err: argument to `seed` not supported, got FLOAT"},
+		{`rand(1)`, "Err: wrong number of arguments. expected=0 got=1"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testBooleanObject(t, testEval(`seed(42); let a = rand_int(1000); seed(42); a == rand_int(1000)`), true)
+	testBooleanObject(t, testEval(`let r = rand_int(3); r >= 0 && r < 3`), true)
+	testBooleanObject(t, testEval(`let r = rand(); r >= 0 && r < 1`), true)
+
+	// evaluators seeded alike produce the same numbers
+	program := parser.New(lexer.New(`[rand_int(1000000), rand_int(1000000), rand()]`)).ParseProgram()
+	first := New(WithSeed(7)).Eval(program, object.NewEnvironment())
+	second := New(WithSeed(7)).Eval(program, object.NewEnvironment())
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded evaluators should agree. got=%s and %s", first.Inspect(), second.Inspect())
+	}
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`format_time(0, "2006-01-02 15:04:05")`, "1970-01-01 00:00:00"},
+		{`format_time(1700000000123, "2006-01-02T15:04:05.000")`, "2023-11-14T22:13:20.123"},
+		{`format_time("0", "2006")`, "Err: argument to `format_time` not supported, got STRING"},
+		{`format_time(0, 2006)`, "Err: argument to `format_time` must be a STRING, got INTEGER"},
+		{`now(1)`, "Err: wrong number of arguments. expected=0 got=1"},
+		{`clock(1)`, "Err: wrong number of arguments. expected=0 got=1"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 2020-01-01, to make sure now() is in milliseconds rather than seconds
+	testBooleanObject(t, testEval(`now() > 1577836800000`), true)
+	testBooleanObject(t, testEval(`let start = clock(); let i = 0; while (i < 100) { i = i + 1 }; clock() >= start`), true)
+}
+
+func TestHttpBuiltins(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Type"), body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`http_get(url)["status"]`, 200},
+		{`http_get(url + "/missing")["status"]`, 404},
+		{`http_get(url)["headers"]["X-Method"]`, "GET"},
+		{`let r = http_post(url, "{}", {"Content-Type": "application/json"}); [r["status"], r["body"]]`, []interface{}{200, "application/json {}"}},
+		{`http_post(url, "hi")["headers"]["X-Method"]`, "POST"},
+		{`http_get(1)`, "Err: argument to `http_get` not supported, got INTEGER"},
+		{`http_post(url, 1)`, "Err: argument to `http_post` must be a STRING body, got INTEGER"},
+		{`http_post(url, "", {"a": 1})`, "Err: headers passed to `http_post` must be strings, got STRING: INTEGER"},
+		{`http_post(url)`, "Err: wrong number of arguments. expected=2 or 3 got=1"},
+	}
+
+	for _, tt := range tests {
+		input := fmt.Sprintf("let url = %q; %s", server.URL, tt.input)
+		testObject(t, testEval(input), tt.expected)
+	}
+
+	if _, ok := testEval(`http_get("http://")`).(*object.Error); !ok {
+		t.Errorf("a failed request should be an error")
+	}
+}
+
+func TestExecBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`exec("echo", ["hello", "world"])["stdout"]`, "hello world\n"},
+		{`let r = exec("sh", ["-c", "echo oops >&2; exit 3"]); [r["stderr"], r["exit_code"]]`, []interface{}{"oops\n", 3}},
+		{`exec("true")["exit_code"]`, 0},
+		{`exec("echo", "hi")`, "Err: argument to `exec` must be an ARRAY of arguments, got STRING"},
+		{`exec("echo", [1])`, "Err: arguments passed to `exec` must be strings, got INTEGER"},
+		{`exec()`, "Err: wrong number of arguments. expected=1 or 2 got=0"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	if _, ok := testEval(`exec("surely-not-a-real-command")`).(*object.Error); !ok {
+		t.Errorf("running a missing command should be an error")
+	}
+}
+
+func TestEnvironmentBuiltins(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "bananas")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`env("MONKEY_TEST_VAR")`, "bananas"},
+		{`env("MONKEY_TEST_UNSET_VAR")`, nil},
+		{`set_env("MONKEY_TEST_VAR", "apples"); env("MONKEY_TEST_VAR")`, "apples"},
+		{`exec("sh", ["-c", "echo $MONKEY_TEST_VAR"])["stdout"]`, "apples\n"},
+		{`args()`, []interface{}{}},
+		{`env(1)`, "Err: argument to `env` not supported, got INTEGER"},
+		{`set_env("A")`, "Err: wrong number of arguments. expected=2 got=1"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	program := parser.New(lexer.New(`args()`)).ParseProgram()
+	evaluated := New(WithArgs([]string{"foo", "bar"})).Eval(program, object.NewEnvironment())
+	testObject(t, evaluated, []interface{}{"foo", "bar"})
+}
+
+func TestSandbox(t *testing.T) {
+	for _, name := range []string{"exec", "env", "set_env", "http_get", "http_post"} {
+		program := parser.New(lexer.New(name + `("x")`)).ParseProgram()
+		evaluated := New(WithSandbox()).Eval(program, object.NewEnvironment())
+		testError(t, evaluated, "identifier not found: "+name)
+	}
+
+	program := parser.New(lexer.New(`len("safe")`)).ParseProgram()
+	testIntegerObject(t, New(WithSandbox()).Eval(program, object.NewEnvironment()), 4)
+}
+
+func TestSandboxProfile(t *testing.T) {
+	tests := []struct {
+		profile  SandboxProfile
+		input    string
+		expected interface{}
+	}{
+		{DefaultSandboxProfile, `len("abc")`, 3},
+		{DefaultSandboxProfile, `exec("ls")`, "identifier not found: exec"},
+		{DefaultSandboxProfile, `while (true) {}`, "step limit of 10000000 exceeded"},
+		// ordinary scripts fit in the default budget
+		{DefaultSandboxProfile, `let a = []; let i = 0; while (i < 5000) { a = push(a, i); i += 1 };
+		  let words = split(join(map(a, str), " "), " ");
+		  let counts = {}; let j = 0; while (j < 100) { counts = put(counts, words[j], j); j += 1 };
+		  let b = string_builder(); let k = 0; while (k < 5000) { write(b, words[k], ","); k += 1 };
+		  reduce(filter(a, fn(x) { x < 2500 }), 0, fn(acc, x) { acc + x }) + len(keys(counts)) + len(str(b))`,
+			3123750 + 100 + 23890},
+		{SandboxProfile{Builtins: []string{"len"}}, `len([1])`, 1},
+		{SandboxProfile{Builtins: []string{"len"}}, `first([1])`, "identifier not found: first"},
+		{SandboxProfile{Builtins: []string{"exec"}}, `exec("ls")`, "identifier not found: exec"},
+		{SandboxProfile{NoIO: true}, `puts(1)`, "identifier not found: puts"},
+		{SandboxProfile{MaxAlloc: 10}, `"hello" + " world"`, "allocation limit of 10 bytes exceeded"},
+		{SandboxProfile{MaxDepth: 2}, `let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(5)`, "maximum recursion depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithSandboxProfile(tt.profile)).Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testError(t, evaluated, expected)
+		}
+	}
+
+	// a profile without limits doesn't lift the ones set before it
+	program := parser.New(lexer.New(`while (true) { "x" + "y" }`)).ParseProgram()
+	evaluated := New(WithMaxSteps(100), WithSandboxProfile(SandboxProfile{})).Eval(program, object.NewEnvironment())
+	testError(t, evaluated, "step limit of 100 exceeded")
+	evaluated = New(WithMaxAlloc(10), WithSandboxProfile(SandboxProfile{})).Eval(program, object.NewEnvironment())
+	testError(t, evaluated, "allocation limit of 10 bytes exceeded")
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	double := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}}
+	eval := func(e *Evaluator, input string) object.Object {
+		return e.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	}
+
+	e := New(WithBuiltin("double", double))
+	testIntegerObject(t, eval(e, `double(21)`), 42)
+	testIntegerObject(t, eval(e, `let double = fn(x) { x }; double(21)`), 21)
+
+	e.Builtins().Unregister("len")
+	testError(t, eval(e, `len("abc")`), "identifier not found: len")
+	e.Builtins().Register("len", double)
+	testIntegerObject(t, eval(e, `len(2)`), 4)
+
+	// registries belong to a single evaluator
+	testIntegerObject(t, eval(New(), `len("abc")`), 3)
+	testError(t, eval(New(), `double(1)`), "identifier not found: double")
+
+	names := New(WithSandbox()).Builtins().Names()
+	if !slices.Contains(names, "len") || slices.Contains(names, "exec") || !slices.IsSorted(names) {
+		t.Errorf("unexpected sandboxed builtins. got=%v", names)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`puts("hello", 1, [true])`, "hello\n1\n[true]\n"},
+		{`puts()`, ""},
+		{`print("a", 2); print("b")`, "a 2b"},
+		{`let f = fn(x) { puts(x * 2) }; f(2); f(3)`, "4\n6\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithOutput(&out)).Eval(program, object.NewEnvironment())
+
+		if evaluated != NULL {
+			t.Errorf("output builtins should return NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected interface{}
+		output   string
+	}{
+		{`input()`, "hello\nworld\n", "hello", ""},
+		{`input("name? ")`, "monkey", "monkey", "name? "},
+		{`[input(), input()]`, "a\r\nb\n", []interface{}{"a", "b"}, ""},
+		{`int(input()) + 1`, "41\n", 42, ""},
+		{`input()`, "", nil, ""},
+		{`input(1, 2)`, "", "Err: wrong number of arguments. expected at most 1 got=2", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		e := New(WithInput(strings.NewReader(tt.stdin)), WithOutput(&out))
+
+		testObject(t, e.Eval(program, object.NewEnvironment()), tt.expected)
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestArray(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []interface{}
+	}{
+		{`[1,"string"];`, []interface{}{1, "string"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
 		array, ok := evaluated.(*object.Array)
 		if !ok {
 			t.Errorf("object is not array. got=%T (%+v)", evaluated, evaluated)
@@ -420,6 +1748,25 @@ func TestArray(t *testing.T) {
 	}
 }
 
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let rest = [2, 3]; [1, ...rest, 9]`, []interface{}{1, 2, 3, 9}},
+		{`[...[], ...["a"]]`, []interface{}{"a"}},
+		{`let arr = [1]; let other = [2, 3]; push(arr, ...other)`, []interface{}{1, 2, 3}},
+		{`let add = fn(a, b) { a + b }; add(...[1, 2])`, 3},
+		{`let arr = [1]; push(arr, ...[2]); arr`, []interface{}{1}},
+		{`[...1]`, "Err: cannot spread INTEGER"},
+		{`...[1]`, "Err: spread is only allowed in function calls and array literals"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestHashes(t *testing.T) {
 	input := `{1:"string", "foo": true, fn(){"bar"}(): fn(){ "hello, world!"}}`
 	evaluated := testEval(input)
@@ -429,7 +1776,7 @@ func TestHashes(t *testing.T) {
 		t.Fatalf("object is not hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	for _, pair := range hash.Pairs {
+	for _, pair := range hash.Pairs() {
 		switch v := pair.Value.(type) {
 		case *object.Function:
 			if v.Body.String() != "hello, world!" {
@@ -459,6 +1806,136 @@ func TestHashes(t *testing.T) {
 	testError(t, testEval(`{fn(){"hello"}:true}`), "Cannot use as key FUNCTION")
 }
 
+func TestDelayAndForce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`force(delay(1 + 2))`, 3},
+		{`let n = 0; let t = delay(n += 1); force(t); force(t); n`, 1},
+		{`let n = 0; let t = delay(n += 1); n`, 0},
+		{`let t = delay(1 + true); 5`, 5},
+		{`force(delay(1 + true))`, "Err: type mismatch: INTEGER + BOOLEAN"},
+		{`let from = fn(n) { [n, delay(from(n + 1))] }; force(force(from(1)[1])[1])[0]`, 3},
+		{`force(4)`, 4},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSlicing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[1, 2, 3, 4][1:3]`, []interface{}{2, 3}},
+		{`[1, 2, 3, 4][:2]`, []interface{}{1, 2}},
+		{`[1, 2, 3, 4][2:]`, []interface{}{3, 4}},
+		{`[1, 2, 3, 4][:]`, []interface{}{1, 2, 3, 4}},
+		{`[1, 2, 3][-5:10]`, []interface{}{1, 2, 3}},
+		{`[1, 2, 3][2:1]`, []interface{}{}},
+		{`let a = [1, 2]; let b = a[:]; push(b, 3); a`, []interface{}{1, 2}},
+		{`"héllo"[1:4]`, "éll"},
+		{`"hello"[3:]`, "lo"},
+		{`"hello"[10:]`, ""},
+		{`1[0:1]`, "Err: Cannot slice type INTEGER"},
+		{`[1][true:]`, "Err: Cannot use as slice bound BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDotAccess(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "Alice", "age": 30}; person.name`, "Alice"},
+		{`let person = {"name": "Alice", "age": 30}; person.age + 1`, 31},
+		{`let a = {"b": {"c": [1, 2]}}; a.b.c[1]`, 2},
+		{`let f = fn() { {"x": 5} }; f().x`, 5},
+		{`1.x`, "Err: cannot access x on INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval(`let person = {"name": "Alice"}; person.age`))
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let p = {"address": {"city": "Paris"}}; p?.address?.city`, "Paris"},
+		{`let p = {"tags": ["a", "b"]}; p?.tags?.[1]`, "b"},
+		{`let p = {"name": "Bob"}; p.address.city`, "Err: cannot access city on NULL"},
+		{`let p = [1, 2]; p?.len()`, 2},
+		{`1?.x`, "Err: cannot access x on INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	nulls := []string{
+		`let p = {"name": "Bob"}; p?.address?.city`,
+		`let p = {}; p.list?.[0]`,
+		`let calls = 0; let f = fn() { calls += 1 }; let p = {}; p.x?.len(f())`,
+	}
+	for _, input := range nulls {
+		testNullObject(t, testEval(input))
+	}
+	testIntegerObject(t, testEval(`let calls = 0; let f = fn() { calls += 1 }; let p = {}; p.x?.len(f()); calls`), 0)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[1, 2, 3].len()`, 3},
+		{`"héllo".len()`, 5},
+		{`[1].push(2).push(3)`, []interface{}{1, 2, 3}},
+		{`let double = fn(x) { x * 2 }; 4.double()`, 8},
+		{`let add = fn(a, b) { a + b }; 1.add(2).add(3)`, 6},
+		{`let counter = {"next": fn(n) { n + 1 }}; counter.next(1)`, 2},
+		{`let len = 1; {"len": fn() { 7 }}.len()`, 7},
+		{`1.nope()`, "Err: identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let double = fn(x) { x * 2 }; 3 |> double`, 6},
+		{`let double = fn(x) { x * 2 }; let sub = fn(a, b) { a - b }; 3 |> double |> sub(1)`, 5},
+		{`[1, 2] |> push(3) |> len`, 3},
+		{`"abc" |> len == 3`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(bool); ok {
+			testBooleanObject(t, evaluated, expected)
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestIndexing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -471,7 +1948,12 @@ func TestIndexing(t *testing.T) {
 		{`{2: true, "false": fn(){3}, false: "hello"}[2]`, true},
 		{`{2: true, "false": fn(){3}, false: "hello"}["false"]()`, 3},
 		{`{2: true, "false": fn(){3}, false: "hello"}[false]`, "hello"},
-		{`let var = 1; {2: true, "false": fn(){3}, false: "hello"}[var]`, true},
+		{`let var = 1; {2: true, "false": fn(){3}, false: "hello"}[var]`, nil},
+		{`{1: 2}[3]`, nil},
+		{`let h = {"a": 1}; if (h["b"]) { 1 } else { 2 }`, 2},
+		{`"hello"[1]`, "e"},
+		{`let s = "hello"; s[len(s) - 1]`, "o"},
+		{`"日本語"[2]`, "語"},
 	}
 
 	for _, tt := range tests {
@@ -485,4 +1967,332 @@ func TestIndexing(t *testing.T) {
 	testError(t, testEval(`[3, 4][-1]`), "Cannot index with a negative number -1")
 	testError(t, testEval(`{1:true}[fn(){"hello"}]`), "Cannot use as index FUNCTION")
 	testError(t, testEval(`{1:true}[[1]]`), "Cannot use as index ARRAY")
+	testError(t, testEval(`"abc"[3]`), "Index is larger than the max. index=3, max=2")
+	testError(t, testEval(`"abc"[-1]`), "Cannot index with a negative number -1")
+	testError(t, testEval(`"abc"["a"]`), "Cannot use as index STRING")
+}
+
+func TestEvalCtx(t *testing.T) {
+	tests := []string{
+		`while (true) {}`,
+		`fn loop() { loop() }; loop()`,
+		`let f = fn(n) { f(n + 1) + 1 }; f(0)`,
+		`while (true) { try { while (true) {} } catch (e) {} }`,
+		`map([1, 2, 3], fn(x) { while (true) {} })`,
+	}
+
+	for _, input := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		evaluated := EvalCtx(ctx, program, object.NewEnvironment())
+		cancel()
+
+		err, ok := evaluated.(*object.Error)
+		if !ok || err.Kind != object.CANCELLED_ERROR {
+			t.Errorf("expected %q to be cancelled. got=%T (%+v)", input, evaluated, evaluated)
+		}
+	}
+
+	// the evaluator can be used again once the context is gone
+	e := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	program := parser.New(lexer.New(`fn f() { 1 }; f()`)).ParseProgram()
+	testError(t, e.EvalCtx(ctx, program, object.NewEnvironment()), "context canceled")
+	testIntegerObject(t, e.Eval(program, object.NewEnvironment()), 1)
+}
+
+func TestMaxSteps(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxSteps int
+		expected interface{}
+	}{
+		{`1 + 2`, 10, 3},
+		{`1 + 2`, 3, "step limit of 3 exceeded"},
+		{`let i = 0; while (i < 10) { i += 1 }; i`, 50, "step limit of 50 exceeded"},
+		{`let i = 0; while (i < 10) { i += 1 }; i`, 1000, 10},
+		{`fn loop() { loop() }; loop()`, 1000, "step limit of 1000 exceeded"},
+		{`try { while (true) {} } catch (e) { 1 }`, 1000, "step limit of 1000 exceeded"},
+		{`1 + 2`, 0, 3}, // no limit
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithMaxSteps(tt.maxSteps)).Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testError(t, evaluated, expected)
+			if err, ok := evaluated.(*object.Error); ok && err.Kind != object.LIMIT_ERROR {
+				t.Errorf("wrong error kind for %q. got=%s", tt.input, err.Kind)
+			}
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	countdown := `let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; `
+	spawnDeep := `fn deep(n, task) {
+		if (n > 0) { return 1 + deep(n - 1, task) }
+		let hs = []; let i = 0; while (i < 50) { hs = push(hs, spawn task()); i += 1 };
+		reduce(hs, 0, fn(acc, h) { acc + wait(h) })
+	}; `
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected interface{}
+	}{
+		{countdown + `f(100)`, 100, "maximum recursion depth exceeded"},
+		{countdown + `f(99)`, 100, 99},
+		{countdown + `f(1000000)`, DefaultMaxDepth, "maximum recursion depth exceeded"},
+		{`fn loop(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(1000)`, 10, 0}, // tail calls
+		{countdown + `try { f(100) } catch (e) { f(10) }`, 50, 10},
+		// each spawned call has a call chain of its own, even when it's spawned deep down another
+		{countdown + spawnDeep + `deep(60, fn() { f(60) })`, 100, 60 + 50*60},
+		{countdown + spawnDeep + `deep(60, fn() { map([60], f)[0] })`, 100, 60 + 50*60},
+		{countdown + `wait(spawn f(100))`, 100, "maximum recursion depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithMaxDepth(tt.maxDepth)).Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testError(t, evaluated, expected)
+		}
+	}
+
+	program := parser.New(lexer.New(countdown + `f(5)`)).ParseProgram()
+	err, ok := New(WithMaxDepth(3)).Eval(program, object.NewEnvironment()).(*object.Error)
+	expected := "RuntimeError at 1:47: maximum recursion depth exceeded\n  in f called at 1:47\n  ... repeated 2 more times\n  in f called at 1:61"
+	if !ok || err.Traceback() != expected {
+		t.Errorf("wrong traceback.\nexpected=%q\ngot=     %v", expected, err)
+	}
+}
+
+func TestMaxAlloc(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxAlloc int
+		expected interface{}
+	}{
+		{`len("hello" + " world")`, 100, 11},
+		{`"a" + "b"`, 1, "allocation limit of 1 bytes exceeded"},
+		{`let a = []; while (true) { a = push(a, 1) }`, 1 << 20, "allocation limit of 1048576 bytes exceeded"},
+		{`let s = "x"; while (true) { s = s + s }`, 1 << 20, "allocation limit of 1048576 bytes exceeded"},
+		{`try { let a = [1, 2, 3, 4]; } catch (e) { 1 }`, 32, "allocation limit of 32 bytes exceeded"},
+		{`len([1, 2, 3])`, 0, 3}, // no limit
+		// builtins count the storage they add, not everything they return
+		{`let a = []; let i = 0; while (i < 10000) { a = push(a, i); i += 1 }; len(a)`, 2 * 16 * 10000, 10000},
+		{`let a = [1, 2, 3]; let i = 0; while (i < 10000) { first(a); last(a); rest(a); i += 1 }; i`, 100, 10000},
+		{`let k = "a"; let h = {k: "xyz"}; let i = 0; while (i < 10000) { get(h, k); str(h[k]); i += 1 }; i`, 100, 10000},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(WithMaxAlloc(tt.maxAlloc)).Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testError(t, evaluated, expected)
+			if err, ok := evaluated.(*object.Error); ok && err.Kind != object.LIMIT_ERROR {
+				t.Errorf("wrong error kind for %q. got=%s", tt.input, err.Kind)
+			}
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var trace bytes.Buffer
+	program := parser.New(lexer.New(`let f = fn(x) { x * 2 }; f(1 + 2)`)).ParseProgram()
+	e := New(WithTrace(&trace))
+	testIntegerObject(t, e.Eval(program, object.NewEnvironment()), 6)
+
+	expected := `1:9 FunctionLiteralExpression -> fn(x) { (x * 2) }
+1:1 LetStatement -> fn(x) { (x * 2) }
+1:26 Identifier -> fn(x) { (x * 2) }
+1:32 IntegerLiteral -> 2
+1:28 IntegerLiteral -> 1
+1:28 InfixExpression -> 3
+  1:21 IntegerLiteral -> 2
+  1:17 Identifier -> 3
+  1:17 InfixExpression -> 6
+  1:17 ExpressionStatement -> 6
+  1:15 BlockStatement -> 6
+1:26 FunctionCallExpression -> 6
+1:26 ExpressionStatement -> 6
+1:1 Program -> 6
+`
+	if trace.String() != expected {
+		t.Errorf("wrong trace.\nexpected=%q\ngot=     %q", expected, trace.String())
+	}
+
+	trace.Reset()
+	e.SetTrace(nil)
+	e.Eval(program, object.NewEnvironment())
+	if trace.Len() != 0 {
+		t.Errorf("expected no trace once turned off. got=%q", trace.String())
+	}
+}
+
+func TestProfile(t *testing.T) {
+	input := `fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }
+let double = fn(x) { x * 2 };
+map([1, 2, 3], double);
+fib(5)`
+	profile := NewProfile()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	testIntegerObject(t, New(WithProfile(profile)).Eval(program, object.NewEnvironment()), 5)
+
+	calls := map[string]int{}
+	for _, entry := range profile.Entries() {
+		calls[entry.Function] = entry.Calls
+		if entry.Function == "fib" && entry.Pos.Line != 1 {
+			t.Errorf("wrong position for fib. got=%s", entry.Pos)
+		}
+	}
+	// calls from inside builtins, like those made by map, aren't seen
+	expected := map[string]int{"fib": 15, "map": 1}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("wrong calls. expected=%v, got=%v", expected, calls)
+	}
+
+	var report bytes.Buffer
+	profile.Report(&report)
+	if !strings.Contains(report.String(), "fib (1:11)") {
+		t.Errorf("report doesn't mention fib:\n%s", report.String())
+	}
+}
+
+func TestLongInfixChains(t *testing.T) {
+	// deep enough to overflow the Go stack if evaluated recursively
+	input := "0" + strings.Repeat(" + 1", 1000000)
+	testIntegerObject(t, testEval(input), 1000000)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2 - 3 * 4 + 5", -4},
+		{"1 - 2 - 3 - 4", -8},
+		{"1 < 2 == true", true},
+		{"1 + 2 + true + 4", "TypeError at 1:7: type mismatch: INTEGER + BOOLEAN"},
+		{"1 + 2 + nope + 4", "NameError at 1:9: identifier not found: nope"},
+		{"nope + 2 + 3", "NameError at 1:1: identifier not found: nope"},
+		{"1 + 2 + 3 && false", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	e := New()
+	env := object.NewEnvironment()
+	reload := func(input string) []string {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		names, err := e.Reload(program, env)
+		if err != nil {
+			t.Fatalf("reload of %q failed: %s", input, err.Inspect())
+		}
+		return names
+	}
+	eval := func(input string) object.Object {
+		return e.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	version1 := `let count = 0; fn bump() { count = count + 1 }; puts("loaded");`
+	if names := reload(version1); fmt.Sprint(names) != "[count bump]" {
+		t.Errorf("wrong names on the first load. got=%v", names)
+	}
+	eval(`bump(); bump();`)
+
+	// unchanged definitions keep their state
+	if names := reload(version1); len(names) != 0 {
+		t.Errorf("nothing should be reloaded. got=%v", names)
+	}
+	testIntegerObject(t, eval(`count`), 2)
+
+	version2 := `let count = 0; fn bump() { count = count + 10 }; let [a, b] = [1, 2];`
+	if names := reload(version2); fmt.Sprint(names) != "[bump a b]" {
+		t.Errorf("wrong names after a change. got=%v", names)
+	}
+	eval(`bump()`)
+	testIntegerObject(t, eval(`count`), 12)
+
+	// definitions that went missing are defined again
+	env.Restore(object.NewEnvironment().Snapshot())
+	if names := reload(version2); fmt.Sprint(names) != "[count bump a b]" {
+		t.Errorf("wrong names after clearing the environment. got=%v", names)
+	}
+
+	program := parser.New(lexer.New(`let x = nope;`)).ParseProgram()
+	if _, err := e.Reload(program, env); err == nil {
+		t.Errorf("expected an error from a failing definition")
+	}
+
+	// definitions that ran before a failing one aren't run again once it's fixed
+	version3 := `let total = 0; fn add(n) { total = total + n }; let y = nope;`
+	program = parser.New(lexer.New(version3)).ParseProgram()
+	if names, err := e.Reload(program, env); err == nil || fmt.Sprint(names) != "[total add]" {
+		t.Errorf("expected [total add] and an error. got=%v, %v", names, err)
+	}
+	eval(`add(5)`)
+	if names := reload(`let total = 0; fn add(n) { total = total + n }; let y = 1;`); fmt.Sprint(names) != "[y]" {
+		t.Errorf("wrong names after fixing the error. got=%v", names)
+	}
+	testIntegerObject(t, eval(`total`), 5)
+}
+
+// building a string piece by piece; concatenation copies the string so far
+// every time, the builder doesn't
+func BenchmarkStringConcatenation(b *testing.B) {
+	benchmarkProgram(b, `let s = ""; let i = 0; while (i < 2000) { s = s + "piece"; i += 1 }; len(s)`)
+}
+
+func BenchmarkStringBuilder(b *testing.B) {
+	benchmarkProgram(b, `let s = string_builder(); let i = 0; while (i < 2000) { write(s, "piece"); i += 1 }; len(str(s))`)
+}
+
+func benchmarkProgram(b *testing.B, input string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		b.Fatal(p.Errors())
+	}
+	for i := 0; i < b.N; i++ {
+		if result := Eval(program, object.NewEnvironment()); isError(result) {
+			b.Fatal(result.Inspect())
+		}
+	}
+}
+
+func BenchmarkArithmeticLoop(b *testing.B) {
+	benchmarkProgram(b, `let total = 0; let i = 0; while (i < 1000) { total = total + i / 7 - i / 9; i += 1 }; total`)
+}
+
+// building an array with push, and taking it apart again with first and rest
+func BenchmarkPushAndRest(b *testing.B) {
+	benchmarkProgram(b, `let a = []; let i = 0; while (i < 2000) { a = push(a, i); i += 1 };
+let sum = fn(a, acc) { if (len(a) < 2) { acc + first(a) } else { sum(rest(a), acc + first(a)) } };
+sum(a, 0)`)
 }
@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"monkey/token"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Profile records how often each function is called and how long the calls
+// take, including the calls made from them. Tail calls are part of the call
+// they replace.
+type Profile struct {
+	mu      sync.Mutex
+	entries map[profileKey]*ProfileEntry
+}
+
+type ProfileEntry struct {
+	Function string
+	Pos      token.Position // where the function is defined; not valid for builtins
+	Calls    int
+	Time     time.Duration
+}
+
+// anonymous functions are told apart by where they're defined
+type profileKey struct {
+	function string
+	pos      token.Position
+}
+
+func NewProfile() *Profile {
+	return &Profile{entries: make(map[profileKey]*ProfileEntry)}
+}
+
+func (p *Profile) record(function string, pos token.Position, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := profileKey{function, pos}
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &ProfileEntry{Function: function, Pos: pos}
+		p.entries[key] = entry
+	}
+	entry.Calls++
+	entry.Time += elapsed
+}
+
+// Entries returns what has been recorded, the most time consuming first
+func (p *Profile) Entries() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := []ProfileEntry{}
+	for _, entry := range p.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Time != entries[j].Time {
+			return entries[i].Time > entries[j].Time
+		}
+		return entries[i].Function < entries[j].Function
+	})
+	return entries
+}
+
+// Report writes the entries as a table
+func (p *Profile) Report(w io.Writer) {
+	fmt.Fprintf(w, "%10s %12s  %s\n", "calls", "time", "function")
+	for _, entry := range p.Entries() {
+		function := entry.Function
+		if entry.Pos.IsValid() {
+			function += " (" + entry.Pos.String() + ")"
+		}
+		fmt.Fprintf(w, "%10d %12s  %s\n", entry.Calls, entry.Time.Round(time.Microsecond), function)
+	}
+}
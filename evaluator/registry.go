@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+	"sync"
+)
+
+// Registry holds the builtins available to the programs run by an evaluator.
+// Names bound in the environment take precedence over builtins.
+type Registry struct {
+	mu       sync.RWMutex
+	builtins map[string]*object.Builtin
+}
+
+func NewRegistry() *Registry {
+	return &Registry{builtins: make(map[string]*object.Builtin)}
+}
+
+// the builtins of a new evaluator; those that need the evaluator are bound to e
+func defaultRegistry(e *Evaluator) *Registry {
+	r := NewRegistry()
+	for name, builtin := range builtins {
+		r.Register(name, builtin)
+	}
+	for name, builtin := range unsafeBuiltins {
+		r.Register(name, builtin)
+	}
+	e.evaluatorBuiltins = make(map[*object.Builtin]func(*Evaluator) *object.Builtin)
+	for name, newBuiltin := range evaluatorBuiltins {
+		builtin := newBuiltin(e)
+		e.evaluatorBuiltins[builtin] = newBuiltin
+		r.Register(name, builtin)
+	}
+	return r
+}
+
+// Register adds a builtin, replacing any existing builtin of the same name
+func (r *Registry) Register(name string, builtin *object.Builtin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.builtins[name] = builtin
+}
+
+// Unregister removes a builtin, if there is one of that name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.builtins, name)
+}
+
+func (r *Registry) Lookup(name string) (*object.Builtin, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	builtin, ok := r.builtins[name]
+	return builtin, ok
+}
+
+// Names returns the names of the registered builtins in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := []string{}
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Reload runs the top-level definitions (let, fn and enum statements) of a
+// new version of a program in env, skipping those that are unchanged since the
+// last reload and still bound, so the state they hold is kept. Other
+// statements aren't run. It returns the names that were bound, or an error.
+func (e *Evaluator) Reload(program *ast.Program, env *object.Environment) ([]string, object.Object) {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	if e.loaded == nil {
+		e.loaded = make(map[*object.Environment]map[string]bool)
+	}
+	previous := e.loaded[env]
+	loaded := make(map[string]bool)
+
+	rebound := []string{}
+	for _, stmt := range program.Statements {
+		names := definedNames(stmt)
+		if names == nil {
+			continue
+		}
+
+		source := stmt.String()
+		if previous[source] && allBound(env, names) {
+			loaded[source] = true
+			continue
+		}
+
+		if err, ok := e.Eval(stmt, env).(*object.Error); ok {
+			// what ran before the error stays loaded, so fixing the error
+			// doesn't run it again and reset its state
+			for source := range previous {
+				loaded[source] = true
+			}
+			e.loaded[env] = loaded
+			return rebound, err
+		}
+		loaded[source] = true
+		rebound = append(rebound, names...)
+	}
+
+	e.loaded[env] = loaded
+	return rebound, nil
+}
+
+// the names bound by a top-level definition, or nil if stmt isn't one
+func definedNames(stmt ast.Statement) []string {
+	var idents []*ast.Identifier
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		idents = []*ast.Identifier{stmt.Name}
+		if stmt.Pattern != nil {
+			idents = stmt.Pattern.Names()
+		}
+	case *ast.FunctionStatement:
+		idents = []*ast.Identifier{stmt.Name}
+	case *ast.EnumStatement:
+		idents = []*ast.Identifier{stmt.Name}
+	default:
+		return nil
+	}
+
+	names := []string{}
+	for _, ident := range idents {
+		names = append(names, ident.Value)
+	}
+	return names
+}
+
+func allBound(env *object.Environment, names []string) bool {
+	for _, name := range names {
+		if _, ok := env.Get(name); !ok {
+			return false
+		}
+	}
+	return true
+}
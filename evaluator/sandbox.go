@@ -0,0 +1,48 @@
+package evaluator
+
+import "slices"
+
+// SandboxProfile bundles the restrictions for running untrusted code
+type SandboxProfile struct {
+	Builtins []string // the builtins programs may use; nil allows all but the unsafe ones
+	MaxSteps int      // see WithMaxSteps; 0 keeps the current limit
+	MaxAlloc int      // see WithMaxAlloc; 0 keeps the current limit
+	MaxDepth int      // see WithMaxDepth; 0 keeps the current limit
+	NoIO     bool     // leaves out puts, print and input
+}
+
+// DefaultSandboxProfile is a reasonable starting point for untrusted code,
+// e.g. in a playground
+var DefaultSandboxProfile = SandboxProfile{
+	MaxSteps: 10_000_000,
+	MaxAlloc: 64 << 20,
+}
+
+// builtins that talk to the user of the program
+var ioBuiltins = []string{"puts", "print", "input"}
+
+// WithSandboxProfile applies all the restrictions of p, on top of WithSandbox.
+// Builtins registered after it with WithBuiltin are still available.
+func WithSandboxProfile(p SandboxProfile) Option {
+	return func(e *Evaluator) {
+		WithSandbox()(e)
+
+		for _, name := range e.builtins.Names() {
+			allowed := p.Builtins == nil || slices.Contains(p.Builtins, name)
+			if !allowed || (p.NoIO && slices.Contains(ioBuiltins, name)) {
+				e.builtins.Unregister(name)
+			}
+		}
+
+		// limits left at 0 keep whatever was set before
+		if p.MaxSteps > 0 {
+			e.maxSteps = int64(p.MaxSteps)
+		}
+		if p.MaxAlloc > 0 {
+			e.maxAlloc = int64(p.MaxAlloc)
+		}
+		if p.MaxDepth > 0 {
+			e.maxDepth = int64(p.MaxDepth)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package format
+
+import (
+	"errors"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+const indent = "    "
+
+// Source formats a program, keeping its comments. Programs that don't parse
+// are returned unchanged, along with the parser errors.
+func Source(src string) (string, error) {
+	p := parser.New(lexer.New(src, lexer.WithComments()))
+	program := p.ParseProgram()
+	if len(p.ParserErrors()) != 0 {
+		errs := []error{}
+		for _, err := range p.ParserErrors() {
+			errs = append(errs, err)
+		}
+		return src, errors.Join(errs...)
+	}
+
+	f := &formatter{comments: ast.NewCommentMap(program)}
+	f.program(program)
+	return f.out.String(), nil
+}
+
+// Node formats a single node as source code
+func Node(node ast.Node) string {
+	f := &formatter{}
+	switch node := node.(type) {
+	case *ast.Program:
+		f.program(node)
+		return strings.TrimSuffix(f.out.String(), "\n")
+	case ast.Statement:
+		f.statement(node)
+	case ast.Expression:
+		f.expression(node)
+	}
+	return f.out.String()
+}
+
+type formatter struct {
+	out      strings.Builder
+	depth    int
+	comments ast.CommentMap
+	lastLine int // the source line the output has caught up with
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+}
+
+func (f *formatter) newline() {
+	f.write("\n" + strings.Repeat(indent, f.depth))
+}
+
+func (f *formatter) program(program *ast.Program) {
+	f.statements(program.Statements)
+	f.commentLines(f.comments[program].Dangling)
+	if f.out.Len() > 0 {
+		f.write("\n")
+	}
+}
+
+func (f *formatter) statements(statements []ast.Statement) {
+	for _, stmt := range statements {
+		comments := f.comments[stmt]
+		f.commentLines(comments.Leading)
+		f.startLine(stmt.Pos().Line)
+		f.statement(stmt)
+
+		// trailing comments stay at the end of the line
+		f.lastLine = stmt.End().Line
+		for _, comment := range comments.Trailing {
+			f.write(" " + comment.Text)
+			f.lastLine = comment.End().Line
+		}
+	}
+}
+
+// starts a new line for something on the given line of the source
+func (f *formatter) startLine(line int) {
+	if f.out.Len() == 0 {
+		return
+	}
+	// a single blank line is kept wherever the source had one or more
+	if f.lastLine > 0 && line > f.lastLine+1 {
+		f.write("\n")
+	}
+	f.newline()
+}
+
+// prints comments on lines of their own
+func (f *formatter) commentLines(comments []*ast.Comment) {
+	for _, comment := range comments {
+		f.startLine(comment.Pos().Line)
+		f.write(comment.Text)
+		f.lastLine = comment.End().Line
+	}
+}
+
+func (f *formatter) block(block *ast.BlockStatement) {
+	dangling := f.comments[block].Dangling
+	if len(block.Statements) == 0 && len(dangling) == 0 {
+		f.write("{}")
+		return
+	}
+
+	f.write("{")
+	f.depth += 1
+	f.lastLine = 0 // blocks don't start with a blank line
+	f.statements(block.Statements)
+	f.commentLines(dangling)
+	f.depth -= 1
+	f.newline()
+	f.write("}")
+	f.lastLine = block.Rbrace.Line
+}
+
+func (f *formatter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		f.write("let ")
+		switch pattern := stmt.Pattern.(type) {
+		case *ast.ArrayPattern:
+			f.write("[" + names(pattern.Elements) + "]")
+		case *ast.HashPattern:
+			f.write("{" + names(pattern.Keys) + "}")
+		default:
+			f.write(stmt.Name.Value)
+		}
+		if stmt.Value != nil {
+			f.write(" = ")
+			f.expression(stmt.Value)
+		}
+		f.write(";")
+
+	case *ast.FunctionStatement:
+		f.write("fn " + stmt.Name.Value + "(" + names(stmt.Function.Parameters) + ") ")
+		f.block(stmt.Function.Body)
+
+	case *ast.EnumStatement:
+		f.write("enum " + stmt.Name.Value + " { " + names(stmt.Variants) + " }")
+
+	case *ast.ReturnStatement:
+		f.write("return ")
+		f.expression(stmt.ReturnValue)
+		f.write(";")
+
+	case *ast.ThrowStatement:
+		f.write("throw ")
+		f.expression(stmt.Value)
+		f.write(";")
+
+	case *ast.BreakStatement:
+		f.write("break;")
+
+	case *ast.ContinueStatement:
+		f.write("continue;")
+
+	case *ast.ExpressionStatement:
+		f.expression(stmt.Expression)
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.WhileExpression, *ast.TryExpression:
+			// these end in a block already
+		default:
+			f.write(";")
+		}
+
+	case *ast.BlockStatement:
+		f.block(stmt)
+	}
+}
+
+// binding powers of the expressions that aren't plain infix expressions;
+// everything else binds as tightly as a call
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.FunctionCallExpression:
+		if piped(exp) {
+			return parser.PIPE
+		}
+	case *ast.PrefixExpression, *ast.SpreadExpression:
+		return parser.PREFIX
+	case *ast.YieldExpression, *ast.SpawnExpression:
+		return parser.LOWEST
+	}
+	return parser.CALL
+}
+
+// x |> f and x |> f(y) are parsed into calls with x as the first argument
+func piped(call *ast.FunctionCallExpression) bool {
+	if call.Token.Type == token.PIPE {
+		return true
+	}
+	if len(call.Parameters) == 0 {
+		return false
+	}
+	first, function := call.Parameters[0].Pos(), call.Function.Pos()
+	return first.IsValid() && function.IsValid() && first.Before(function)
+}
+
+// compound assignments like x += 1 are parsed into x = x + 1, with the
+// infix expression at the position of the operator
+func compound(exp *ast.AssignExpression) (*ast.InfixExpression, bool) {
+	value, ok := exp.Value.(*ast.InfixExpression)
+	if !ok || !exp.Token.Pos().IsValid() {
+		return nil, false
+	}
+	return value, value.Token.Pos() == exp.Token.Pos() && value.Left == exp.Name
+}
+
+// wraps the expression in parentheses if it binds less tightly than minimum
+func (f *formatter) operand(exp ast.Expression, minimum int) {
+	if precedence(exp) < minimum {
+		f.write("(")
+		f.expression(exp)
+		f.write(")")
+		return
+	}
+	f.expression(exp)
+}
+
+func (f *formatter) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		f.write(exp.Value)
+
+	case *ast.IntegerLiteral:
+		f.write(strconv.FormatInt(exp.Value, 10))
+
+	case *ast.FloatLiteral:
+		f.write(exp.Token.Literal)
+
+	case *ast.BooleanExpression:
+		f.write(strconv.FormatBool(exp.Value))
+
+	case *ast.StringLiteral:
+		// strings can't escape quotes, so ones containing them must be raw
+		if strings.Contains(exp.Value, `"`) {
+			f.write("`" + exp.Value + "`")
+		} else {
+			f.write(`"` + exp.Value + `"`)
+		}
+
+	case *ast.PrefixExpression:
+		f.write(exp.Operator)
+		f.operand(exp.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		// infix operators are left-associative
+		prec := precedence(exp)
+		f.operand(exp.Left, prec)
+		f.write(" " + exp.Operator + " ")
+		f.operand(exp.Right, prec+1)
+
+	case *ast.AssignExpression:
+		f.write(exp.Name.Value)
+		if value, ok := compound(exp); ok {
+			f.write(" " + value.Operator + "= ")
+			f.operand(value.Right, parser.ASSIGN)
+			return
+		}
+		f.write(" = ")
+		f.operand(exp.Value, parser.ASSIGN)
+
+	case *ast.IfExpression:
+		f.write("if (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			f.write(" else ")
+			f.block(exp.Alternative)
+		}
+
+	case *ast.WhileExpression:
+		f.write("while (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Body)
+
+	case *ast.TryExpression:
+		f.write("try ")
+		f.block(exp.Body)
+		f.write(" catch (" + exp.Param.Value + ") ")
+		f.block(exp.Handler)
+
+	case *ast.DelayExpression:
+		f.write("delay(")
+		f.expression(exp.Value)
+		f.write(")")
+
+	case *ast.YieldExpression:
+		f.write("yield ")
+		f.expression(exp.Value)
+
+	case *ast.SpawnExpression:
+		f.write("spawn ")
+		f.expression(exp.Call)
+
+	case *ast.FunctionLiteralExpression:
+		f.write("fn(" + names(exp.Parameters) + ") ")
+		f.block(exp.Body)
+
+	case *ast.FunctionCallExpression:
+		if piped(exp) {
+			f.operand(exp.Parameters[0], parser.PIPE)
+			f.write(" |> ")
+			if exp.Token.Type == token.PIPE {
+				f.operand(exp.Function, parser.PIPE+1)
+				return
+			}
+			f.operand(exp.Function, parser.CALL)
+			f.write("(")
+			f.expressions(exp.Parameters[1:])
+			f.write(")")
+			return
+		}
+		f.operand(exp.Function, parser.CALL)
+		f.write("(")
+		f.expressions(exp.Parameters)
+		f.write(")")
+
+	case *ast.ArrayLiteral:
+		f.write("[")
+		f.expressions(exp.Elements)
+		f.write("]")
+
+	case *ast.SpreadExpression:
+		f.write("...")
+		f.operand(exp.Value, parser.PREFIX)
+
+	case *ast.IndexingExpression:
+		f.operand(exp.Target, parser.CALL)
+		if exp.Optional {
+			f.write("?.")
+		}
+		f.write("[")
+		f.expression(exp.Index)
+		f.write("]")
+
+	case *ast.SliceExpression:
+		f.operand(exp.Target, parser.CALL)
+		f.write("[")
+		if exp.Start != nil {
+			f.expression(exp.Start)
+		}
+		f.write(":")
+		if exp.Stop != nil {
+			f.expression(exp.Stop)
+		}
+		f.write("]")
+
+	case *ast.AccessExpression:
+		f.operand(exp.Target, parser.CALL)
+		if exp.Optional {
+			f.write("?.")
+		} else {
+			f.write(".")
+		}
+		f.write(exp.Key.Value)
+
+	case *ast.HashLiteral:
+		f.write("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(pair.Key)
+			f.write(": ")
+			f.expression(pair.Value)
+		}
+		f.write("}")
+	}
+}
+
+func (f *formatter) expressions(list []ast.Expression) {
+	for i, exp := range list {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.expression(exp)
+	}
+}
+
+func names(idents []*ast.Identifier) string {
+	list := []string{}
+	for _, ident := range idents {
+		list = append(list, ident.Value)
+	}
+	return strings.Join(list, ", ")
+}
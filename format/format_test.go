@@ -0,0 +1,111 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3;", "let x = 1 + 2 * 3;\n"},
+		{"let x = (1 + 2) * 3;", "let x = (1 + 2) * 3;\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c);\na - b - c;\n"},
+		{"-(a + b); !!x; - -1", "-(a + b);\n!!x;\n--1;\n"},
+		{"let f = fn(x,y){x+y};", "let f = fn(x, y) {\n    x + y;\n};\n"},
+		{"fn f() {}", "fn f() {}\n"},
+		{"if (x) { 1 } else { 2 }", "if (x) {\n    1;\n} else {\n    2;\n}\n"},
+		{"x += 1; x = x + 1", "x += 1;\nx = x + 1;\n"},
+		{"a = b = 1", "a = b = 1;\n"},
+		{"xs |> map(f) |> len", "xs |> map(f) |> len;\n"},
+		{"(a + b) |> f", "a + b |> f;\n"},
+		{"(a |> f) + 1", "(a |> f) + 1;\n"},
+		{`let s = ["a", ` + "`say \"hi\"`" + `];`, "let s = [\"a\", `say \"hi\"`];\n"},
+		{`{"a": 1, "b": [...xs][1:]}`, `{"a": 1, "b": [...xs][1:]};` + "\n"},
+		{"a?.b?.[0]; a.b(1)[2]", "a?.b?.[0];\na.b(1)[2];\n"},
+		{"let [a,b]=c; let {d}=e; let f;", "let [a, b] = c;\nlet {d} = e;\nlet f;\n"},
+		{"enum Color {Red,Green};", "enum Color { Red, Green }\n"},
+		{"while(x){break;continue}", "while (x) {\n    break;\n    continue;\n}\n"},
+		{"try{throw 1}catch(e){e}", "try {\n    throw 1;\n} catch (e) {\n    e;\n}\n"},
+		{"let g = fn() { yield 1; }; spawn f(delay(2))", "let g = fn() {\n    yield 1;\n};\nspawn f(delay(2));\n"},
+		{"1;\n\n\n2;\n3", "1;\n\n2;\n3;\n"},
+		{"fn f() {\n\n  1\n}", "fn f() {\n    1;\n}\n"},
+		{
+			"// leading\nlet x = 1; // trailing\n\n/* block */\nx",
+			"// leading\nlet x = 1; // trailing\n\n/* block */\nx;\n",
+		},
+		{
+			"let f = fn() { 1 }; // after\nfn g() {\n  // only a comment\n}",
+			"let f = fn() {\n    1;\n}; // after\nfn g() {\n    // only a comment\n}\n",
+		},
+		{"// nothing else", "// nothing else\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err)
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong formatting for %q.\nexpected=%q\ngot=     %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+// formatting must not change what the program means, and formatted source
+// must already be formatted
+func TestSourceRoundTrip(t *testing.T) {
+	input := `
+let add = fn(x, y) { x + y }; // adds
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let xs = [1, 2, 3] |> map(fn(x) { x * 2 }) |> filter(fn(x) { x > 2 });
+let total = 0;
+while (total < 10) { total += xs[0]; if (total == 4) { break; } }
+let h = {"k": -(1 - 2) * 3 / 4};
+let g = fn() { try { throw "no" } catch (e) { yield e.message } };
+`
+	formatted, err := Source(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if again, _ := Source(formatted); again != formatted {
+		t.Errorf("formatting isn't stable.\nfirst=%s\nsecond=%s", formatted, again)
+	}
+
+	original := parser.New(lexer.New(input)).ParseProgram()
+	reparsed := parser.New(lexer.New(formatted)).ParseProgram()
+	if original.String() != reparsed.String() {
+		t.Errorf("formatting changed the program.\nexpected=%s\ngot=%s", original.String(), reparsed.String())
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	input := "let x = ;"
+	formatted, err := Source(input)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if err.Error() != "1:9: No prefix parse function found for ;" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+	if formatted != input {
+		t.Errorf("source should be returned unchanged. got=%q", formatted)
+	}
+}
+
+func TestNode(t *testing.T) {
+	exp, errs := parser.ParseExpressionString("(1 + 2) * fn(x) { x }(3)")
+	if len(errs) != 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	expected := "(1 + 2) * fn(x) {\n    x;\n}(3)"
+	if formatted := Node(exp); formatted != expected {
+		t.Errorf("wrong formatting. expected=%q got=%q", expected, formatted)
+	}
+}
@@ -68,7 +68,11 @@ func evalGraph(graph *cgraph.Graph, ast_node ast.Node, parent *cgraph.Node, edge
 			fmt.Printf("Error creating graph node " + err.Error())
 			return
 		}
-		evalGraph(graph, ast_node.Name, graph_node, "Name")
+		if ast_node.Pattern != nil {
+			evalGraph(graph, ast_node.Pattern, graph_node, "Pattern")
+		} else {
+			evalGraph(graph, ast_node.Name, graph_node, "Name")
+		}
 		evalGraph(graph, ast_node.Value, graph_node, "Value")
 
 	case *ast.FunctionLiteralExpression:
@@ -141,6 +145,18 @@ func evalGraph(graph *cgraph.Graph, ast_node ast.Node, parent *cgraph.Node, edge
 		evalGraph(graph, ast_node.Left, graph_node, "Left")
 		evalGraph(graph, ast_node.Right, graph_node, "Right")
 
+	case *ast.HashLiteral:
+		n, err := graph.CreateNode("HASH_LITERAL\n" + ast_node.String())
+		graph_node = n
+		if err != nil {
+			fmt.Printf("Error creating graph node " + err.Error())
+			return
+		}
+		for _, pair := range ast_node.Pairs {
+			evalGraph(graph, pair.Key, graph_node, "Key")
+			evalGraph(graph, pair.Value, graph_node, "Value")
+		}
+
 	default:
 		n, err := graph.CreateNode(fmt.Sprintf("%T\n%s", ast_node, ast_node.String()))
 		graph_node = n
@@ -1,34 +1,137 @@
 package lexer
 
-import "monkey/token"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/token"
+	"sort"
+	"strings"
+	"unicode"
+)
 
 type Lexer struct {
-	input        string
-	position     int  // current position in the input (char)
-	readPosition int  // current reading position (after current char)
-	ch           byte // current char under examination
+	reader io.RuneReader
+	ahead  []char // chars read from the reader but not consumed yet
+	ch     rune   // current char under examination
+	width  int    // size of the current char in bytes
+	line   int    // line of the current char
+	column int    // column of the current char, counted in bytes
+	file   string
+	errors []string
+
+	comments  bool     // emit COMMENT tokens rather than skipping comments
+	operators []string // extra operators, longest first
+}
+
+type Option func(*Lexer)
+
+// WithComments makes the lexer return comments as COMMENT tokens, e.g. for
+// tools that need to preserve them
+func WithComments() Option {
+	return func(l *Lexer) {
+		l.comments = true
+	}
+}
+
+// WithOperators makes the lexer recognise extra symbolic operators, e.g. `**`.
+// Each one is returned as a token whose type is its literal.
+func WithOperators(literals ...string) Option {
+	return func(l *Lexer) {
+		l.operators = append(l.operators, literals...)
+		// the longest match wins, so `**=` isn't read as `**` followed by `=`
+		sort.SliceStable(l.operators, func(i, j int) bool {
+			return len(l.operators[i]) > len(l.operators[j])
+		})
+	}
 }
 
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+type char struct {
+	ch    rune
+	width int
+}
+
+// WithLine numbers the lines of the input starting from the given line, e.g.
+// for a REPL that numbers lines across its inputs
+func WithLine(line int) Option {
+	return func(l *Lexer) {
+		l.line = line
+	}
+}
+
+func New(input string, opts ...Option) *Lexer {
+	return NewFile("", input, opts...)
+}
+
+// NewFile lexes the contents of a file, recording its name in every token
+func NewFile(file string, input string, opts ...Option) *Lexer {
+	return newLexer(file, strings.NewReader(input), opts)
+}
+
+// NewFromReader lexes the input as it's read, rather than needing all of it up front
+func NewFromReader(r io.Reader, opts ...Option) *Lexer {
+	return newLexer("", r, opts)
+}
+
+func newLexer(file string, r io.Reader, opts []Option) *Lexer {
+	reader, ok := r.(io.RuneReader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
+
+	l := &Lexer{reader: reader, line: 1, column: 1, file: file}
+	for _, opt := range opts {
+		opt(l)
+	}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.column += l.width
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
+
+	next := l.peek(0)
+	l.ahead = l.ahead[1:]
+	l.ch, l.width = next.ch, next.width
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// looks n chars past the current one; the end of the input reads as 0
+func (l *Lexer) peek(n int) char {
+	for len(l.ahead) <= n {
+		ch, width, err := l.reader.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				// reported once, the rest of the input is treated as missing
+				l.errors = append(l.errors, fmt.Sprintf("failed to read input: %s", err))
+				l.reader = strings.NewReader("")
+			}
+			ch, width = 0, 0
+		}
+		l.ahead = append(l.ahead, char{ch: ch, width: width})
+	}
+	return l.ahead[n]
+}
 
-	l.skipWhitespace()
+func (l *Lexer) NextToken() (tok token.Token) {
+	l.skipWhitespaceAndComments()
+	line, column := l.line, l.column
+	defer func() {
+		tok.File = l.file
+		tok.Line = line
+		tok.Column = column
+	}()
+
+	if literal, ok := l.matchOperator(); ok {
+		for range literal {
+			l.readChar()
+		}
+		return token.Token{Type: token.TokenType(literal), Literal: literal}
+	}
 
 	switch l.ch {
 	case '=':
@@ -56,17 +159,61 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = "+="
+			tok.Type = token.PLUS_ASSIGN
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = "-="
+			tok.Type = token.MINUS_ASSIGN
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = "*="
+			tok.Type = token.ASTERISK_ASSIGN
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.comments && l.peekChar() == '/' {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readLineComment()
+			return tok
+		} else if l.comments && l.peekChar() == '*' {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readBlockComment()
+			return tok
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = "/="
+			tok.Type = token.SLASH_ASSIGN
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = "<="
+			tok.Type = token.LT_EQ
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Literal = ">="
+			tok.Type = token.GT_EQ
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -75,11 +222,51 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok.Literal = "&&"
+			tok.Type = token.AND
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok.Literal = "||"
+			tok.Type = token.OR
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok.Literal = "|>"
+			tok.Type = token.PIPE
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' && l.peek(1).ch == '.' {
+			l.readChar()
+			l.readChar()
+			tok.Literal = "..."
+			tok.Type = token.SPREAD
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok.Literal = "?."
+			tok.Type = token.OPTIONAL_CHAIN
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readstring()
+	case '`':
+		tok.Type = token.STRING
+		tok.Literal = l.readRawString()
 
 	default:
 		if isLetter(l.ch) {
@@ -87,8 +274,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -102,44 +288,168 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r' {
+func (l *Lexer) matchOperator() (string, bool) {
+	for _, literal := range l.operators {
+		matched := true
+		for i, r := range []rune(literal) {
+			ch := l.ch
+			if i > 0 {
+				ch = l.peek(i - 1).ch
+			}
+			if ch != r {
+				matched = false
+				break
+			}
+		}
+		if matched && literal != "" {
+			return literal, true
+		}
+	}
+	return "", false
+}
+
+func (l *Lexer) skipWhitespaceAndComments() {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/' && !l.comments:
+			l.readLineComment()
+		case l.ch == '/' && l.peekChar() == '*' && !l.comments:
+			l.readBlockComment()
+		default:
+			return
+		}
+	}
+}
+
+// reads to the end of the line; the newline itself is left as whitespace
+func (l *Lexer) readLineComment() string {
+	var out strings.Builder
+	for l.ch != '\n' && l.ch != 0 {
+		out.WriteRune(l.ch)
+		l.readChar()
+	}
+	return out.String()
+}
+
+// block comments nest, so /* a /* b */ c */ is a single comment
+func (l *Lexer) readBlockComment() string {
+	line, column := l.line, l.column
+	var out strings.Builder
+	depth := 0
+
+	for l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth += 1
+			out.WriteRune(l.ch)
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth -= 1
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+		out.WriteRune(l.ch)
 		l.readChar()
+
+		if depth == 0 {
+			return out.String()
+		}
 	}
+
+	msg := fmt.Sprintf("unterminated block comment starting at %s", l.positionOf(line, column))
+	l.errors = append(l.errors, msg)
+	return out.String()
 }
 
+func (l *Lexer) positionOf(line int, column int) string {
+	return token.Position{File: l.file, Line: line, Column: column}.String()
+}
+
+// Tokens reads the rest of the input, returning every token up to and including EOF
+func (l *Lexer) Tokens() []token.Token {
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// Errors returns the problems found while reading the input
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+// identifiers start with a letter and may contain digits after that
 func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
+	var out strings.Builder
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
+		out.WriteRune(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return out.String()
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+// raw strings may span lines and are kept exactly as written
+func (l *Lexer) readRawString() string {
+	line, column := l.line, l.column
+	var out strings.Builder
+	for {
 		l.readChar()
+		if l.ch == '`' {
+			break
+		}
+		if l.ch == 0 {
+			msg := fmt.Sprintf("unterminated raw string starting at %s", l.positionOf(line, column))
+			l.errors = append(l.errors, msg)
+			break
+		}
+		out.WriteRune(l.ch)
 	}
-	return l.input[position:l.position]
+
+	return out.String()
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	var out strings.Builder
+	tokenType := token.TokenType(token.INT)
+	for isDigit(l.ch) {
+		out.WriteRune(l.ch)
+		l.readChar()
 	}
-	return l.input[l.readPosition]
+
+	// a fractional part needs a digit after the dot
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		out.WriteRune(l.ch)
+		l.readChar()
+		for isDigit(l.ch) {
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+
+	return out.String(), tokenType
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.peek(0).ch
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// letters of any script are allowed
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
@@ -147,13 +457,14 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 }
 
 func (l *Lexer) readstring() string {
-	position := l.position + 1
+	var out strings.Builder
 	for {
 		l.readChar()
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+		out.WriteRune(l.ch)
 	}
 
-	return l.input[position:l.position]
+	return out.String()
 }
@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"monkey/token"
 )
@@ -15,7 +17,7 @@ func TestNextToken(t *testing.T) {
     };
 
     let result = add(five, ten);
-    !-/*5;
+    !-/ *5;
     5 < 10 > 5;
 
     if(5 < 10) {
@@ -157,3 +159,566 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + 10;`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"10", 2, 7},
+		{";", 2, 9},
+		{"", 2, 10},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tsts[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i,
+				tt.expectedLine,
+				tt.expectedColumn,
+				tok.Line,
+				tok.Column)
+		}
+	}
+}
+
+func TestFloatTokens(t *testing.T) {
+	input := `3.14 + 2. 10.5.1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.PLUS, "+"},
+		{token.INT, "2"},
+		{token.DOT, "."},
+		{token.FLOAT, "10.5"},
+		{token.DOT, "."},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestCompoundAssignTokens(t *testing.T) {
+	input := `x += 1; x -= 2; x *= 3; x /= 4; x + = 5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLogicalTokens(t *testing.T) {
+	input := `a && b || c & d`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonTokens(t *testing.T) {
+	input := `a <= b >= c < = d`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "d"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestPipeToken(t *testing.T) {
+	input := `x |> f || g | h`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "g"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "h"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestOptionalChainToken(t *testing.T) {
+	input := `a?.b ?`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.OPTIONAL_CHAIN, "?."},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, "?"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestSpreadToken(t *testing.T) {
+	input := `[...rest] ..`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.SPREAD, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLineComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+x / 2 // no newline at the end
+"http://example.com"
+//`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.STRING, "http://example.com"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	input := `/* leading */ let /* inline */ x = 5;
+/* spans
+   lines */ x /* nested /* comment */ still comment */ * 2 /**/
+"/* not a comment */"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK, "*"},
+		{token.INT, "2"},
+		{token.STRING, "/* not a comment */"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	input := "let s = `line one\n  \"two\" \\n\n`;\nlet t = ``;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "s", 1},
+		{token.ASSIGN, "=", 1},
+		{token.STRING, "line one\n  \"two\" \\n\n", 1},
+		{token.SEMICOLON, ";", 3},
+		{token.LET, "let", 4},
+		{token.IDENT, "t", 4},
+		{token.ASSIGN, "=", 4},
+		{token.STRING, "", 4},
+		{token.SEMICOLON, ";", 4},
+		{token.EOF, "", 4},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tsts[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
+		}
+	}
+
+	l = New("x `never closed")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.STRING || tok.Literal != "never closed" {
+		t.Fatalf("unexpected token. got=%+v", tok)
+	}
+	expected := "unterminated raw string starting at 1:3"
+	if len(l.Errors()) != 1 || l.Errors()[0] != expected {
+		t.Fatalf("unexpected lexer errors. expected=%q got=%v", expected, l.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("x /* never /* closed */")
+
+	if tok := l.NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.IDENT, tok.Type)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	expected := "unterminated block comment starting at 1:3"
+	if len(l.Errors()) != 1 || l.Errors()[0] != expected {
+		t.Fatalf("unexpected lexer errors. expected=%q got=%v", expected, l.Errors())
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	input := "let s = \"héllo\" + `wörld`;\nlen(s) ... x"
+
+	// one byte at a time, so multi-byte chars are split across reads
+	streamed := NewFromReader(iotest.OneByteReader(strings.NewReader(input)))
+	l := New(input)
+	for {
+		expected := l.NextToken()
+		tok := streamed.NextToken()
+
+		if tok != expected {
+			t.Fatalf("token wrong. expected=%+v, got=%+v", expected, tok)
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	// columns are counted in bytes
+	l = New("\"é\" + x")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.IDENT && tok.Column != 8 {
+			t.Fatalf("column wrong. expected=8, got=%d", tok.Column)
+		}
+	}
+
+	l = NewFromReader(iotest.TimeoutReader(strings.NewReader("x y z")))
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+	expected := "failed to read input: timeout"
+	if len(l.Errors()) != 1 || l.Errors()[0] != expected {
+		t.Fatalf("unexpected lexer errors. expected=%q got=%v", expected, l.Errors())
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let café = 1;\nlet 名前 = café2 + x_1;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "café", 5},
+		{token.ASSIGN, "=", 11},
+		{token.INT, "1", 13},
+		{token.SEMICOLON, ";", 14},
+		{token.LET, "let", 1},
+		{token.IDENT, "名前", 5},
+		{token.ASSIGN, "=", 12},
+		{token.IDENT, "café2", 14},
+		{token.PLUS, "+", 21},
+		{token.IDENT, "x_1", 23},
+		{token.SEMICOLON, ";", 26},
+		{token.EOF, "", 27},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Column != tt.expectedColumn {
+			t.Fatalf("tsts[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 1; /* a /* nested */\n comment */ x / 2"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.COMMENT, "// header", 1},
+		{token.LET, "let", 2},
+		{token.IDENT, "x", 2},
+		{token.ASSIGN, "=", 2},
+		{token.INT, "1", 2},
+		{token.SEMICOLON, ";", 2},
+		{token.COMMENT, "/* a /* nested */\n comment */", 2},
+		{token.IDENT, "x", 3},
+		{token.SLASH, "/", 3},
+		{token.INT, "2", 3},
+		{token.EOF, "", 3},
+	}
+
+	l := New(input, WithComments())
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tsts[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tsts[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tsts[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
+		}
+	}
+
+	// without the option, comments are skipped
+	l = New(input)
+	if tok := l.NextToken(); tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := New("let x = 1;\nx").Tokens()
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.INT, Literal: "1", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.IDENT, Literal: "x", Line: 2, Column: 1},
+		{Type: token.EOF, Literal: "", Line: 2, Column: 2},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestWithOperators(t *testing.T) {
+	tokens := New("2 ** 3 **= x * y <=> z", WithOperators("**", "**=", "<=>")).Tokens()
+
+	expected := []token.Token{
+		{Type: token.INT, Literal: "2", Line: 1, Column: 1},
+		{Type: "**", Literal: "**", Line: 1, Column: 3},
+		{Type: token.INT, Literal: "3", Line: 1, Column: 6},
+		{Type: "**=", Literal: "**=", Line: 1, Column: 8},
+		{Type: token.IDENT, Literal: "x", Line: 1, Column: 12},
+		{Type: token.ASTERISK, Literal: "*", Line: 1, Column: 14},
+		{Type: token.IDENT, Literal: "y", Line: 1, Column: 16},
+		{Type: "<=>", Literal: "<=>", Line: 1, Column: 18},
+		{Type: token.IDENT, Literal: "z", Line: 1, Column: 22},
+		{Type: token.EOF, Literal: "", Line: 1, Column: 23},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%+v)", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package lint
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+type Warning struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Message)
+}
+
+// Lint parses the input and reports suspicious constructs.
+// Parser errors are returned separately; the AST checks only run on programs that parse.
+func Lint(input string) ([]Warning, []parser.ParserError) {
+	warnings := lintTokens(lexer.New(input))
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		warnings = append(warnings, LintProgram(program)...)
+	}
+
+	sortWarnings(warnings)
+	return warnings, p.ParserErrors()
+}
+
+// LintProgram runs the AST checks against an already-parsed program
+func LintProgram(program *ast.Program) []Warning {
+	c := &checker{scope: newScope(nil)}
+	ast.Walk(c, program)
+	c.resolve()
+
+	sortWarnings(c.warnings)
+	return c.warnings
+}
+
+func sortWarnings(warnings []Warning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].Column < warnings[j].Column
+	})
+}
+
+func newWarning(tok token.Token, format string, a ...interface{}) Warning {
+	return Warning{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)}
+}
+
+// the `=` vs `==` mixups are easiest to spot on the raw token stream,
+// since they usually don't survive parsing
+func lintTokens(l *lexer.Lexer) []Warning {
+	warnings := []Warning{}
+
+	var prev, prevPrev token.Token
+	conditionDepth := 0
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch {
+		case tok.Type == token.LPAREN && (conditionDepth > 0 || prev.Type == token.IF):
+			conditionDepth += 1
+		case tok.Type == token.RPAREN && conditionDepth > 0:
+			conditionDepth -= 1
+		case tok.Type == token.ASSIGN && conditionDepth > 0:
+			warnings = append(warnings, newWarning(tok, "suspicious `=` in condition, did you mean `==`?"))
+		case tok.Type == token.EQ && prev.Type == token.IDENT && prevPrev.Type == token.LET:
+			warnings = append(warnings, newWarning(tok, "suspicious `==` in let statement, did you mean `=`?"))
+		}
+
+		prevPrev = prev
+		prev = tok
+	}
+
+	return warnings
+}
+
+type binding struct {
+	token     token.Token
+	used      bool
+	parameter bool
+}
+
+// a scope is introduced by the program and by every function literal;
+// blocks (e.g. if-expressions) share the environment of their enclosing function
+type scope struct {
+	outer    *scope
+	bindings map[string][]*binding
+	order    []*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string][]*binding)}
+}
+
+func (s *scope) declare(tok token.Token, parameter bool) {
+	b := &binding{token: tok, parameter: parameter}
+	s.bindings[tok.Literal] = append(s.bindings[tok.Literal], b)
+	s.order = append(s.order, b)
+}
+
+func (s *scope) lookup(name string) ([]*binding, bool) {
+	for current := s; current != nil; current = current.outer {
+		if bindings, ok := current.bindings[name]; ok {
+			return bindings, true
+		}
+	}
+	return nil, false
+}
+
+type reference struct {
+	scope  *scope
+	token  token.Token
+	isCall bool
+}
+
+// references are resolved once the whole program has been seen, because
+// function bodies may refer to bindings declared after them
+type checker struct {
+	scope      *scope
+	scopes     []*scope
+	references []reference
+	warnings   []Warning
+}
+
+func (c *checker) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.scopes = append(c.scopes, c.scope)
+		c.checkUnreachable(node.Statements)
+
+	case *ast.BlockStatement:
+		c.checkUnreachable(node.Statements)
+
+	case *ast.LetStatement:
+		ast.Walk(c, node.Value)
+		if node.Pattern != nil {
+			for _, name := range node.Pattern.Names() {
+				c.declare(name.Token, false)
+			}
+		} else {
+			c.declare(node.Name.Token, false)
+		}
+		return nil
+
+	case *ast.EnumStatement:
+		c.declare(node.Name.Token, false)
+		return nil
+
+	case *ast.FunctionStatement:
+		c.declare(node.Name.Token, false)
+		ast.Walk(c, node.Function)
+		return nil
+
+	case *ast.FunctionLiteralExpression:
+		inner := &checker{scope: newScope(c.scope)}
+		for _, param := range node.Parameters {
+			inner.declare(param.Token, true)
+		}
+		ast.Walk(inner, node.Body)
+		c.merge(inner)
+		return nil
+
+	case *ast.TryExpression:
+		// the caught value is only visible inside the handler
+		ast.Walk(c, node.Body)
+		inner := &checker{scope: newScope(c.scope)}
+		inner.declare(node.Param.Token, true)
+		ast.Walk(inner, node.Handler)
+		c.merge(inner)
+		return nil
+
+	case *ast.FunctionCallExpression:
+		// recv.f() may call a hash field, so f is only a plain reference
+		if access, ok := node.Function.(*ast.AccessExpression); ok {
+			ast.Walk(c, access.Target)
+			c.references = append(c.references, reference{scope: c.scope, token: access.Key.Token})
+			for _, param := range node.Parameters {
+				ast.Walk(c, param)
+			}
+			return nil
+		}
+		if ident, ok := node.Function.(*ast.Identifier); ok {
+			c.references = append(c.references, reference{scope: c.scope, token: ident.Token, isCall: true})
+			for _, param := range node.Parameters {
+				ast.Walk(c, param)
+			}
+			return nil
+		}
+
+	case *ast.AccessExpression:
+		// the key is a field name rather than a reference
+		ast.Walk(c, node.Target)
+		return nil
+
+	case *ast.Identifier:
+		c.references = append(c.references, reference{scope: c.scope, token: node.Token})
+	}
+
+	return c
+}
+
+func (c *checker) merge(inner *checker) {
+	c.scopes = append(c.scopes, inner.scopes...)
+	c.scopes = append(c.scopes, inner.scope)
+	c.references = append(c.references, inner.references...)
+	c.warnings = append(c.warnings, inner.warnings...)
+}
+
+func (c *checker) declare(tok token.Token, parameter bool) {
+	if c.scope.outer != nil {
+		if shadowed, ok := c.scope.outer.lookup(tok.Literal); ok {
+			original := shadowed[0].token
+			c.warnings = append(c.warnings, newWarning(tok, "%s shadows declaration at %d:%d", tok.Literal, original.Line, original.Column))
+		}
+	}
+	c.scope.declare(tok, parameter)
+}
+
+func (c *checker) checkUnreachable(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if i == len(statements)-1 {
+			break
+		}
+		switch stmt.(type) {
+		case *ast.ReturnStatement:
+			c.warnings = append(c.warnings, newWarning(statementToken(statements[i+1]), "unreachable code after return"))
+			return
+		case *ast.ThrowStatement:
+			c.warnings = append(c.warnings, newWarning(statementToken(statements[i+1]), "unreachable code after throw"))
+			return
+		}
+	}
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.FunctionStatement:
+		return stmt.Token
+	case *ast.EnumStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func (c *checker) resolve() {
+	for _, ref := range c.references {
+		if bindings, ok := ref.scope.lookup(ref.token.Literal); ok {
+			for _, b := range bindings {
+				b.used = true
+			}
+			continue
+		}
+
+		if ref.isCall && !evaluator.IsBuiltin(ref.token.Literal) {
+			c.warnings = append(c.warnings, newWarning(ref.token, "unknown builtin or function %s", ref.token.Literal))
+		}
+	}
+
+	for _, s := range c.scopes {
+		for _, b := range s.order {
+			if !b.used && !b.parameter && !strings.HasPrefix(b.token.Literal, "_") {
+				c.warnings = append(c.warnings, newWarning(b.token, "%s declared and not used", b.token.Literal))
+			}
+		}
+	}
+}
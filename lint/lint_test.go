@@ -0,0 +1,84 @@
+package lint
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; x", []string{}},
+		{"let x = 5;", []string{"1:5: x declared and not used"}},
+		{"let _x = 5;", []string{}},
+		{
+			"let x = 5; let f = fn(x) { x }; f(x)",
+			[]string{"1:23: x shadows declaration at 1:5"},
+		},
+		{
+			"let f = fn() { let y = 2; y }; f()",
+			[]string{},
+		},
+		{
+			"let f = fn() { return 1; 2 }; f()",
+			[]string{"1:26: unreachable code after return"},
+		},
+		{
+			"if (x = 5) { 1 }",
+			[]string{"1:7: suspicious `=` in condition, did you mean `==`?"},
+		},
+		{
+			"let x == 5; x",
+			[]string{"1:7: suspicious `==` in let statement, did you mean `=`?"},
+		},
+		{
+			"len([1]); lenn([1])",
+			[]string{"1:11: unknown builtin or function lenn"},
+		},
+		{
+			"let f = fn() { g() }; let g = fn() { 1 }; f()",
+			[]string{},
+		},
+		{
+			`let name = 1; let person = {"name": 2}; person.name`,
+			[]string{"1:5: name declared and not used"},
+		},
+		{
+			"let double = fn(x) { x * 2 }; [1].len().double().nope()",
+			[]string{},
+		},
+		{
+			"let f = fn() { throw 1; 2 }; f(); try { f() } catch (e) { let x = 1; }",
+			[]string{"1:25: unreachable code after throw", "1:63: x declared and not used"},
+		},
+		{
+			"enum Color { Red, Green } enum Unused { A }; Color.Red",
+			[]string{"1:32: Unused declared and not used"},
+		},
+		{
+			"let [a, b] = [1, 2]; a",
+			[]string{"1:9: b declared and not used"},
+		},
+		{
+			"fn loop(n) { loop(n) }",
+			[]string{},
+		},
+		{
+			"fn unused() { 1 }",
+			[]string{"1:4: unused declared and not used"},
+		},
+	}
+
+	for _, tt := range tests {
+		warnings, _ := Lint(tt.input)
+
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("Unexpected number of warnings for %q. expected=%v got=%v", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, w := range warnings {
+			if w.String() != tt.expected[i] {
+				t.Errorf("Unexpected warning for %q. expected=%q got=%q", tt.input, tt.expected[i], w.String())
+			}
+		}
+	}
+}
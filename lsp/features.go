@@ -0,0 +1,215 @@
+package lsp
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/lint"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// Diagnostics reports parser errors and lint warnings for a document
+func Diagnostics(text string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	warnings, parseErrors := lint.Lint(text)
+	for _, err := range parseErrors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    positionRange(err.Pos.Line, err.Pos.Column, 1),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  err.Message,
+		})
+	}
+	for _, w := range warnings {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    positionRange(w.Line, w.Column, 1),
+			Severity: SeverityWarning,
+			Source:   "monkey-lint",
+			Message:  w.Message,
+		})
+	}
+
+	return diagnostics
+}
+
+// HoverAt describes the identifier under the cursor: the value of a constant
+// let binding, or the documentation of a builtin
+func HoverAt(text string, pos Position) *Hover {
+	tok, ok := tokenAt(text, pos)
+	if !ok || tok.Type != token.IDENT {
+		return nil
+	}
+
+	var contents string
+	if let := findLet(text, tok); let != nil {
+		switch value := let.Value.(type) {
+		case *ast.FunctionLiteralExpression:
+			contents = fmt.Sprintf("let %s = %s", tok.Literal, signature(value))
+		default:
+			if isConstant(value) {
+				evaluated := evaluator.Eval(value, object.NewEnvironment())
+				if evaluated != nil {
+					contents = fmt.Sprintf("let %s = %s", tok.Literal, evaluated.Inspect())
+				}
+			}
+		}
+	} else if doc, ok := evaluator.BuiltinDoc(tok.Literal); ok {
+		contents = doc
+	}
+
+	if contents == "" {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: contents},
+		Range:    positionRange(tok.Line, tok.Column, len(tok.Literal)),
+	}
+}
+
+// Symbols lists every let binding in the document
+func Symbols(uri string, text string) []SymbolInformation {
+	symbols := []SymbolInformation{}
+
+	for _, let := range letStatements(text) {
+		kind := SymbolKindVariable
+		if _, ok := let.Value.(*ast.FunctionLiteralExpression); ok {
+			kind = SymbolKindFunction
+		}
+
+		name := let.Name.Token
+		symbols = append(symbols, SymbolInformation{
+			Name: name.Literal,
+			Kind: kind,
+			Location: Location{
+				URI:   uri,
+				Range: positionRange(name.Line, name.Column, len(name.Literal)),
+			},
+		})
+	}
+
+	return symbols
+}
+
+// Completions offers the bindings of the document, builtins and keywords
+func Completions(text string) []CompletionItem {
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+
+	for _, let := range letStatements(text) {
+		if seen[let.Name.Value] {
+			continue
+		}
+		seen[let.Name.Value] = true
+		items = append(items, CompletionItem{Label: let.Name.Value, Kind: CompletionKindVariable})
+	}
+
+	for _, name := range evaluator.BuiltinNames() {
+		doc, _ := evaluator.BuiltinDoc(name)
+		items = append(items, CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: doc})
+	}
+
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKindKeyword})
+	}
+
+	return items
+}
+
+// tokens are 1-based, LSP positions are 0-based
+func positionRange(line int, column int, length int) Range {
+	start := Position{Line: line - 1, Character: column - 1}
+	if start.Line < 0 {
+		start.Line = 0
+	}
+	if start.Character < 0 {
+		start.Character = 0
+	}
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + length}}
+}
+
+func tokenAt(text string, pos Position) (token.Token, bool) {
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Line-1 != pos.Line {
+			continue
+		}
+		start := tok.Column - 1
+		if start <= pos.Character && pos.Character < start+len(tok.Literal) {
+			return tok, true
+		}
+	}
+	return token.Token{}, false
+}
+
+// named function declarations are reported as the equivalent let statement,
+// destructured names as value-less let statements
+func letStatements(text string) []*ast.LetStatement {
+	program := parser.New(lexer.New(text)).ParseProgram()
+
+	lets := []*ast.LetStatement{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				lets = append(lets, node)
+			}
+			if node.Pattern != nil {
+				for _, name := range node.Pattern.Names() {
+					lets = append(lets, &ast.LetStatement{Token: node.Token, Name: name})
+				}
+			}
+		case *ast.FunctionStatement:
+			lets = append(lets, &ast.LetStatement{Token: node.Token, Name: node.Name, Value: node.Function})
+		}
+		return true
+	})
+	return lets
+}
+
+// finds the closest let binding of the identifier that precedes it
+func findLet(text string, ident token.Token) *ast.LetStatement {
+	var found *ast.LetStatement
+	for _, let := range letStatements(text) {
+		name := let.Name.Token
+		if name.Literal != ident.Literal {
+			continue
+		}
+		if name.Line > ident.Line || (name.Line == ident.Line && name.Column > ident.Column) {
+			continue
+		}
+		found = let
+	}
+	return found
+}
+
+// constant expressions can be evaluated without an environment
+func isConstant(exp ast.Expression) bool {
+	if exp == nil {
+		return false
+	}
+
+	constant := true
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.Identifier, *ast.FunctionCallExpression, *ast.FunctionLiteralExpression, *ast.WhileExpression:
+			constant = false
+		}
+		return constant
+	})
+	return constant
+}
+
+func signature(fn *ast.FunctionLiteralExpression) string {
+	params := ""
+	for i, param := range fn.Parameters {
+		if i > 0 {
+			params += ", "
+		}
+		params += param.Value
+	}
+	return fmt.Sprintf("fn(%s)", params)
+}
@@ -0,0 +1,145 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	diagnostics := Diagnostics("let x = 5;")
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected a single diagnostic, got %d (%+v)", len(diagnostics), diagnostics)
+	}
+
+	expected := Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 5}}
+	if diagnostics[0].Range != expected {
+		t.Errorf("Unexpected range. expected=%+v got=%+v", expected, diagnostics[0].Range)
+	}
+	if diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("Unexpected severity. expected=%d got=%d", SeverityWarning, diagnostics[0].Severity)
+	}
+}
+
+func TestParseErrorDiagnostics(t *testing.T) {
+	diagnostics := Diagnostics("let x = 5;\nlet = 1;")
+
+	if len(diagnostics) == 0 {
+		t.Fatalf("Expected diagnostics for the parse error")
+	}
+
+	expected := Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 5}}
+	if diagnostics[0].Range != expected {
+		t.Errorf("Unexpected range. expected=%+v got=%+v", expected, diagnostics[0].Range)
+	}
+	if diagnostics[0].Severity != SeverityError {
+		t.Errorf("Unexpected severity. expected=%d got=%d", SeverityError, diagnostics[0].Severity)
+	}
+	if diagnostics[0].Message != "unexpected next token expected=IDENT got==" {
+		t.Errorf("Unexpected message. got=%q", diagnostics[0].Message)
+	}
+}
+
+func TestHover(t *testing.T) {
+	input := `let x = 2 * 3;
+let add = fn(a, b) { a + b };
+add(x, len("hi"))`
+
+	tests := []struct {
+		position Position
+		expected string
+	}{
+		{Position{Line: 2, Character: 4}, "let x = 6"},
+		{Position{Line: 2, Character: 1}, "let add = fn(a, b)"},
+		{Position{Line: 2, Character: 8}, "len(value): returns the number of characters in a string, bytes in a byte array or elements in an array or set"},
+		{Position{Line: 0, Character: 8}, ""},
+	}
+
+	for _, tt := range tests {
+		hover := HoverAt(input, tt.position)
+		if hover == nil {
+			if tt.expected != "" {
+				t.Errorf("Expected hover at %+v, got nil", tt.position)
+			}
+			continue
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("Unexpected hover at %+v. expected=%q got=%q", tt.position, tt.expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	symbols := Symbols("file:///a.mky", "let x = 1;\nlet f = fn() { let y = 2; y };\nfn g() { 3 }\nlet [a, b] = [1, 2];")
+
+	expected := []struct {
+		name string
+		kind int
+		line int
+	}{
+		{"x", SymbolKindVariable, 0},
+		{"f", SymbolKindFunction, 1},
+		{"y", SymbolKindVariable, 1},
+		{"g", SymbolKindFunction, 2},
+		{"a", SymbolKindVariable, 3},
+		{"b", SymbolKindVariable, 3},
+	}
+
+	if len(symbols) != len(expected) {
+		t.Fatalf("Unexpected number of symbols. expected=%d got=%d", len(expected), len(symbols))
+	}
+	for i, s := range symbols {
+		if s.Name != expected[i].name || s.Kind != expected[i].kind || s.Location.Range.Start.Line != expected[i].line {
+			t.Errorf("Unexpected symbol. expected=%+v got=%+v", expected[i], s)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	var in bytes.Buffer
+	writeTestMessage(&in, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	writeTestMessage(&in, `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.mky","text":"let x = 1;"}}}`)
+	writeTestMessage(&in, `{"jsonrpc":"2.0","id":2,"method":"textDocument/completion","params":{"textDocument":{"uri":"file:///a.mky"},"position":{"line":0,"character":0}}}`)
+	writeTestMessage(&in, `{"jsonrpc":"2.0","method":"exit"}`)
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve returned an error: %s", err)
+	}
+
+	messages := strings.Split(out.String(), "Content-Length: ")[1:]
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d: %s", len(messages), out.String())
+	}
+
+	var diagnostics struct {
+		Method string
+		Params publishDiagnosticsParams
+	}
+	decodeTestMessage(t, messages[1], &diagnostics)
+	if diagnostics.Method != "textDocument/publishDiagnostics" || len(diagnostics.Params.Diagnostics) != 1 {
+		t.Errorf("Unexpected diagnostics notification: %+v", diagnostics)
+	}
+
+	var completion struct {
+		Result []CompletionItem
+	}
+	decodeTestMessage(t, messages[2], &completion)
+	if len(completion.Result) == 0 || completion.Result[0].Label != "x" {
+		t.Errorf("Unexpected completion: %+v", completion)
+	}
+}
+
+func writeTestMessage(buf *bytes.Buffer, body string) {
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func decodeTestMessage(t *testing.T, message string, v interface{}) {
+	body := message[strings.Index(message, "\r\n\r\n")+4:]
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("Could not decode message %q: %s", body, err)
+	}
+}
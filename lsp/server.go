@@ -0,0 +1,195 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Server speaks the Language Server Protocol over a pair of streams (usually stdio)
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]string
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]string),
+	}
+}
+
+// Serve handles messages until the client sends `exit` or closes the stream
+func (s *Server) Serve() error {
+	for {
+		body, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("malformed message: %w", err)
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req request) error {
+	switch req.Method {
+	case "initialize":
+		return s.reply(req, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full document sync
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "monkey"},
+		})
+
+	case "shutdown":
+		return s.reply(req, nil)
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// full sync: the last change holds the whole document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.update(params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req, invalidParams, err.Error())
+		}
+		return s.reply(req, HoverAt(s.documents[params.TextDocument.URI], params.Position))
+
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req, invalidParams, err.Error())
+		}
+		uri := params.TextDocument.URI
+		return s.reply(req, Symbols(uri, s.documents[uri]))
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req, invalidParams, err.Error())
+		}
+		return s.reply(req, Completions(s.documents[params.TextDocument.URI]))
+
+	default:
+		// notifications we don't understand are ignored, requests get an error
+		if req.ID != nil {
+			return s.replyError(req, methodNotFound, "method not supported: "+req.Method)
+		}
+		return nil
+	}
+}
+
+func (s *Server) update(uri string, text string) error {
+	s.documents[uri] = text
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: Diagnostics(text),
+	})
+}
+
+func (s *Server) reply(req request, result interface{}) error {
+	return s.writeMessage(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) replyError(req request, code int, message string) error {
+	return s.writeMessage(response{JSONRPC: "2.0", ID: req.ID, Error: &responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.writeMessage(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// messages are framed with a Content-Length header, like HTTP
+func (s *Server) readMessage() ([]byte, error) {
+	contentLength := -1
+
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			contentLength, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+
+	if contentLength < 0 {
+		return nil, fmt.Errorf("message is missing a Content-Length header")
+	}
+
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) writeMessage(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
@@ -1,14 +1,50 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"monkey/analyzer"
+	"monkey/ast"
+	"monkey/diagnostics"
+	"monkey/evaluator"
+	"monkey/format"
 	"monkey/grapher"
+	"monkey/lexer"
+	"monkey/lint"
+	"monkey/lsp"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/repl"
+	"monkey/token"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lex":
+			os.Exit(runLex(os.Args[2:]))
+		case "parse":
+			os.Exit(runParse(os.Args[2:]))
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "lsp":
+			os.Exit(runLsp())
+		case "--profile":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "usage: monkey --profile <file> [args]...")
+				os.Exit(2)
+			}
+			os.Exit(runScript(os.Args[2], os.Args[3:], true))
+		default:
+			os.Exit(runScript(os.Args[1], os.Args[2:], false))
+		}
+	}
+
 	runRepl()
 }
 
@@ -32,3 +68,218 @@ func graphAst() {
 	graph := grapher.New(input).GetDot()
 	fmt.Println(graph)
 }
+
+// runs a script, passing it the arguments that follow its name. With profile,
+// the calls the script made are reported on stderr once it has run.
+func runScript(file string, args []string, profile bool) int {
+	input, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	p := parser.New(lexer.NewFile(file, string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		// parser errors already start with the file name
+		for _, err := range p.ParserErrors() {
+			fmt.Fprintln(os.Stderr, diagnostics.Render(string(input), err.Pos, err.Error()))
+		}
+		return 1
+	}
+
+	// warnings are shown, but only errors stop the script from running;
+	// positions already start with the file name
+	problems := analyzer.Analyze(program)
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, diagnostics.Render(string(input), problem.Pos, problem.String()))
+	}
+	if analyzer.HasErrors(problems) {
+		return 1
+	}
+
+	opts := []evaluator.Option{evaluator.WithArgs(args)}
+	if profile {
+		p := evaluator.NewProfile()
+		opts = append(opts, evaluator.WithProfile(p))
+		defer p.Report(os.Stderr)
+	}
+
+	evaluated := evaluator.New(opts...).Eval(program, object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); ok {
+		pos := token.Position{Line: err.Line, Column: err.Column}
+		fmt.Fprintln(os.Stderr, diagnostics.Render(string(input), pos, file+": "+err.Traceback()))
+		return 1
+	}
+	return 0
+}
+
+// prints the tokens of each file, one per line, including comments
+func runLex(files []string) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey lex <file>...")
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		l := lexer.NewFile(file, string(input), lexer.WithComments())
+		for _, tok := range l.Tokens() {
+			fmt.Printf("%s\t%s\t%q\n", tok.Pos(), tok.Type, tok.Literal)
+		}
+
+		for _, msg := range l.Errors() {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		if exitCode == 0 && len(l.Errors()) > 0 {
+			exitCode = 1
+		}
+	}
+
+	return exitCode
+}
+
+// prints the syntax tree of each file as s-expressions, or as JSON with --json
+func runParse(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the syntax tree as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey parse [--json] <file>...")
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range flags.Args() {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		p := parser.New(lexer.NewFile(file, string(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			for _, err := range p.ParserErrors() {
+				fmt.Fprintln(os.Stderr, diagnostics.Render(string(input), err.Pos, err.Error()))
+			}
+			exitCode = 1
+			continue
+		}
+
+		if !*asJSON {
+			fmt.Println(ast.Sexpr(program))
+			continue
+		}
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		fmt.Println(string(data))
+	}
+
+	return exitCode
+}
+
+// prints each file formatted, or rewrites them in place with -w
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey fmt [-w] <file>...")
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range flags.Args() {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		formatted, err := format.Source(string(input))
+		if err != nil {
+			// one parser error per line
+			for _, msg := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", file, msg)
+			}
+			exitCode = 1
+			continue
+		}
+
+		if !*write {
+			fmt.Print(formatted)
+			continue
+		}
+		if formatted == string(input) {
+			continue
+		}
+		if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+		}
+	}
+
+	return exitCode
+}
+
+// lints each file, returning a non-zero exit code if anything was reported
+func runLint(files []string) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey lint <file>...")
+		return 2
+	}
+
+	exitCode := 0
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+
+		warnings, parseErrors := lint.Lint(string(input))
+		for _, err := range parseErrors {
+			if err.Pos.IsValid() {
+				fmt.Printf("%s:%s\n", file, err)
+			} else {
+				fmt.Printf("%s: %s\n", file, err)
+			}
+		}
+		for _, w := range warnings {
+			fmt.Printf("%s:%s\n", file, w)
+		}
+
+		if exitCode == 0 && (len(warnings) > 0 || len(parseErrors) > 0) {
+			exitCode = 1
+		}
+	}
+
+	return exitCode
+}
+
+func runLsp() int {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package object
+
+import (
+	"reflect"
+	"sync"
+)
+
+// channel, for passing messages between spawned calls
+type Channel struct {
+	ch     chan Object
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+// Send blocks until the value is received, or buffered. It reports false if
+// the channel is closed, including when it is closed while waiting.
+func (c *Channel) Send(value Object) (ok bool) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return false
+	}
+
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	c.ch <- value
+	return true
+}
+
+// Recv blocks until a value is sent. It reports false once the channel is
+// closed and drained.
+func (c *Channel) Recv() (Object, bool) {
+	value, ok := <-c.ch
+	return value, ok
+}
+
+// Close reports false if the channel was already closed
+func (c *Channel) Close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	close(c.ch)
+	return true
+}
+
+// RecvAny receives from whichever channel has a value first and returns its
+// index. It reports false once every channel is closed and drained.
+func RecvAny(channels []*Channel) (int, Object, bool) {
+	cases := make([]reflect.SelectCase, len(channels))
+	for i, c := range channels {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)}
+	}
+
+	for open := len(cases); open > 0; {
+		chosen, value, ok := reflect.Select(cases)
+		if ok {
+			return chosen, value.Interface().(Object), true
+		}
+
+		// a nil channel is never ready, which takes the closed one out of the select
+		cases[chosen].Chan = reflect.ValueOf((chan Object)(nil))
+		open -= 1
+	}
+	return 0, nil, false
+}
@@ -1,12 +1,16 @@
 package object
 
+import "sync"
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
 	return env
 }
 
+// environments are shared with spawned calls, so access is guarded
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Object
 	outer *Environment
 }
@@ -17,14 +21,67 @@ func NewEnvironment() *Environment {
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	val, ok := e.store[name]
+	e.mu.RUnlock()
+
 	if !ok && e.outer != nil {
 		val, ok = e.outer.Get(name)
 	}
 	return val, ok
 }
 
+// Assign updates an existing binding in the closest environment that defines it
+func (e *Environment) Assign(name string, value Object) bool {
+	for env := e; env != nil; env = env.outer {
+		env.mu.Lock()
+		_, ok := env.store[name]
+		if ok {
+			env.store[name] = value
+		}
+		env.mu.Unlock()
+
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Environment) Set(name string, value Object) Object {
+	e.mu.Lock()
 	e.store[name] = value
+	e.mu.Unlock()
 	return value
 }
+
+// Snapshot is the state of an environment's own bindings at some point
+type Snapshot struct {
+	store map[string]Object
+}
+
+// Snapshot records the bindings of e so they can be restored later. Only e
+// itself is recorded, not its outer environments, and values aren't copied:
+// changes made inside arrays and hashes aren't undone by Restore.
+func (e *Environment) Snapshot() *Snapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	store := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		store[name] = value
+	}
+	return &Snapshot{store: store}
+}
+
+// Restore puts back the bindings e had when s was taken, removing those made since
+func (e *Environment) Restore(s *Snapshot) {
+	store := make(map[string]Object, len(s.store))
+	for name, value := range s.store {
+		store[name] = value
+	}
+
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
+}
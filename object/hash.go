@@ -0,0 +1,95 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// hash of key-value pairs, kept in insertion order so that it prints and
+// iterates predictably
+type Hash struct {
+	pairs []HashPair
+	index map[HashKey]int
+
+	frozen atomic.Bool // see Freeze
+}
+
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey]int)}
+}
+
+// Freeze marks the hash as immutable, for builtins like put to refuse it.
+// It reports whether the hash wasn't frozen already.
+func (h *Hash) Freeze() bool { return h.frozen.CompareAndSwap(false, true) }
+
+func (h *Hash) Frozen() bool { return h.frozen.Load() }
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Set adds a pair, or updates the value of an existing key in place
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if i, ok := h.index[hashKey]; ok {
+		h.pairs[i].Value = value
+		return
+	}
+	h.index[hashKey] = len(h.pairs)
+	h.pairs = append(h.pairs, HashPair{Key: key.(Object), Value: value})
+}
+
+func (h *Hash) Get(key Hashable) (HashPair, bool) {
+	i, ok := h.index[key.HashKey()]
+	if !ok {
+		return HashPair{}, false
+	}
+	return h.pairs[i], true
+}
+
+func (h *Hash) Delete(key Hashable) {
+	i, ok := h.index[key.HashKey()]
+	if !ok {
+		return
+	}
+
+	delete(h.index, key.HashKey())
+	h.pairs = append(h.pairs[:i], h.pairs[i+1:]...)
+	for j := i; j < len(h.pairs); j++ {
+		h.index[h.pairs[j].Key.(Hashable).HashKey()] = j
+	}
+}
+
+func (h *Hash) Len() int {
+	return len(h.pairs)
+}
+
+// Pairs returns the pairs in the order their keys were added
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.pairs))
+	copy(pairs, h.pairs)
+	return pairs
+}
+
+// Copy returns a copy of the hash, which isn't frozen
+func (h *Hash) Copy() *Hash {
+	result := &Hash{pairs: h.Pairs(), index: make(map[HashKey]int, len(h.index))}
+	for key, i := range h.index {
+		result.index[key] = i
+	}
+	return result
+}
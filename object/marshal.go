@@ -0,0 +1,187 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// values are marshalled as JSON, tagged with their type so that they come
+// back as the same type; hash keys don't have to be strings
+type marshalled struct {
+	Type     ObjectType       `json:"type"`
+	Value    json.RawMessage  `json:"value,omitempty"`
+	Elements []marshalled     `json:"elements,omitempty"`
+	Pairs    []marshalledPair `json:"pairs,omitempty"`
+}
+
+type marshalledPair struct {
+	Key   marshalled `json:"key"`
+	Value marshalled `json:"value"`
+}
+
+// Marshal encodes null, booleans, numbers, strings, bytes, and arrays and hashes of
+// them. Other values, such as functions, can't be marshalled.
+func Marshal(obj Object) ([]byte, error) {
+	m, err := toMarshalled(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// Unmarshal decodes a value encoded by Marshal
+func Unmarshal(data []byte) (Object, error) {
+	var m marshalled
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return fromMarshalled(m)
+}
+
+func toMarshalled(obj Object) (marshalled, error) {
+	m := marshalled{Type: obj.Type()}
+
+	var value interface{}
+	switch obj := obj.(type) {
+	case *Null:
+		return m, nil
+	case *Boolean:
+		value = obj.Value
+	case *Integer:
+		value = obj.Value
+	case *BigInt:
+		value = obj.Value.String()
+	case *Float:
+		value = obj.Value
+	case *Decimal:
+		value = obj.Value.RatString()
+	case *String:
+		value = obj.Value
+	case *Bytes:
+		value = obj.Value // encoded as base64
+	case *Array:
+		m.Elements = []marshalled{}
+		for _, el := range obj.Elements {
+			element, err := toMarshalled(el)
+			if err != nil {
+				return m, err
+			}
+			m.Elements = append(m.Elements, element)
+		}
+		return m, nil
+	case *Hash:
+		m.Pairs = []marshalledPair{}
+		for _, pair := range obj.Pairs() {
+			key, err := toMarshalled(pair.Key)
+			if err != nil {
+				return m, err
+			}
+			value, err := toMarshalled(pair.Value)
+			if err != nil {
+				return m, err
+			}
+			m.Pairs = append(m.Pairs, marshalledPair{Key: key, Value: value})
+		}
+		return m, nil
+	default:
+		return m, fmt.Errorf("cannot marshal %s", obj.Type())
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return m, err
+	}
+	m.Value = raw
+	return m, nil
+}
+
+func fromMarshalled(m marshalled) (Object, error) {
+	switch m.Type {
+	case NULL_OBJ:
+		return NULL, nil
+	case BOOLEAN_OBJ:
+		var value bool
+		if err := json.Unmarshal(m.Value, &value); err != nil {
+			return nil, err
+		}
+		if value {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case INTEGER_OBJ:
+		var value int64
+		if err := json.Unmarshal(m.Value, &value); err != nil {
+			return nil, err
+		}
+		return &Integer{Value: value}, nil
+	case BIGINT_OBJ:
+		var digits string
+		if err := json.Unmarshal(m.Value, &digits); err != nil {
+			return nil, err
+		}
+		value, ok := new(big.Int).SetString(digits, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid BIGINT %q", digits)
+		}
+		return &BigInt{Value: value}, nil
+	case FLOAT_OBJ:
+		var value float64
+		if err := json.Unmarshal(m.Value, &value); err != nil {
+			return nil, err
+		}
+		return &Float{Value: value}, nil
+	case DECIMAL_OBJ:
+		var digits string
+		if err := json.Unmarshal(m.Value, &digits); err != nil {
+			return nil, err
+		}
+		value, ok := new(big.Rat).SetString(digits)
+		if !ok {
+			return nil, fmt.Errorf("invalid DECIMAL %q", digits)
+		}
+		return &Decimal{Value: value}, nil
+	case STRING_OBJ:
+		var value string
+		if err := json.Unmarshal(m.Value, &value); err != nil {
+			return nil, err
+		}
+		return &String{Value: value}, nil
+	case BYTES_OBJ:
+		var value []byte
+		if err := json.Unmarshal(m.Value, &value); err != nil {
+			return nil, err
+		}
+		return &Bytes{Value: value}, nil
+	case ARRAY_OBJ:
+		elements := []Object{}
+		for _, el := range m.Elements {
+			element, err := fromMarshalled(el)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return &Array{Elements: elements}, nil
+	case HASH_OBJ:
+		hash := NewHash()
+		for _, pair := range m.Pairs {
+			key, err := fromMarshalled(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("cannot use as key %s", key.Type())
+			}
+			value, err := fromMarshalled(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashable, value)
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("cannot unmarshal %s", m.Type)
+	}
+}
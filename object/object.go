@@ -2,25 +2,46 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
+	DECIMAL_OBJ      = "DECIMAL"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
+	BYTES_OBJ        = "BYTES"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	THUNK_OBJ        = "THUNK"
+	GENERATOR_OBJ    = "GENERATOR"
+	HANDLE_OBJ       = "HANDLE"
+	CHANNEL_OBJ      = "CHANNEL"
+	SET_OBJ          = "SET"
+	REGEX_OBJ        = "REGEX"
+	ENUM_OBJ         = "ENUM"
+	ENUM_VALUE_OBJ   = "ENUM_VALUE"
+	BUILDER_OBJ      = "STRING_BUILDER"
 )
 
 type Object interface {
@@ -33,12 +54,104 @@ type Integer struct {
 	Value int64
 }
 
+// integers are immutable, so the common small ones are shared, like TRUE and FALSE
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1024
+)
+
+var smallIntegers = func() []Integer {
+	integers := make([]Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range integers {
+		integers[i].Value = int64(i + minCachedInteger)
+	}
+	return integers
+}()
+
+// NewInteger returns an integer object, sharing those of small values
+func NewInteger(value int64) *Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return &smallIntegers[value-minCachedInteger]
+	}
+	return &Integer{Value: value}
+}
+
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// arbitrary-precision integer, only used for values that don't fit in an int64
+type BigInt struct {
+	Value *big.Int
+}
+
+func (bi *BigInt) Inspect() string  { return bi.Value.String() }
+func (bi *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (bi *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(bi.Value.Bytes())
+	if bi.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+// float
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep whole floats distinguishable from integers
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// decimal numbers are exact rationals, for sums (e.g. money) that floats can't represent
+type Decimal struct {
+	Value *big.Rat
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+// decimals print all their digits, unless they repeat forever (e.g. 1/3)
+func (d *Decimal) Inspect() string {
+	denom := new(big.Int).Set(d.Value.Denom())
+	twos, fives := 0, 0
+	for denom.Bit(0) == 0 {
+		denom.Rsh(denom, 1)
+		twos++
+	}
+	five := big.NewInt(5)
+	for new(big.Int).Mod(denom, five).Sign() == 0 {
+		denom.Quo(denom, five)
+		fives++
+	}
+
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return d.Value.FloatString(16)
+	}
+	if twos < fives {
+		twos = fives
+	}
+	if twos == 0 {
+		return d.Value.FloatString(1)
+	}
+	return d.Value.FloatString(twos)
+}
+
+func (d *Decimal) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(d.Value.RatString()))
+	return HashKey{Type: d.Type(), Value: h.Sum64()}
+}
+
 // bool
 type Boolean struct {
 	Value bool
@@ -60,6 +173,13 @@ func (b *Boolean) HashKey() HashKey {
 // null
 type Null struct{}
 
+// the canonical null and booleans; the evaluator compares them by pointer
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 
@@ -71,20 +191,105 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// loop control flow, intercepted by the enclosing loop
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
+// a call in tail position, made by the caller's caller so the stack doesn't grow
+type TailCall struct {
+	Function  *Function
+	Arguments []Object
+}
+
+func (tc *TailCall) Inspect() string  { return "tail call" }
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+
 // error
+// the kinds of runtime error, so that they can be told apart without parsing messages
+type ErrorKind string
+
+const (
+	TYPE_ERROR      ErrorKind = "TypeError"      // a value of the wrong type, e.g. 1 + true
+	INDEX_ERROR     ErrorKind = "IndexError"     // an index or key that isn't there
+	ARITY_ERROR     ErrorKind = "ArityError"     // the wrong number of arguments
+	NAME_ERROR      ErrorKind = "NameError"      // an unknown identifier
+	VALUE_ERROR     ErrorKind = "ValueError"     // the right type, but an unusable value, e.g. int("abc")
+	IO_ERROR        ErrorKind = "IOError"        // a failure outside of the interpreter, e.g. a failed request
+	RUNTIME_ERROR   ErrorKind = "RuntimeError"   // misplaced control flow, closed channels etc.
+	THROWN_ERROR    ErrorKind = "ThrownError"    // a value thrown by user code
+	CANCELLED_ERROR ErrorKind = "CancelledError" // evaluation stopped by the host, e.g. on a timeout; can't be caught
+	LIMIT_ERROR     ErrorKind = "LimitError"     // a resource budget set by the host ran out; can't be caught
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Value   Object // set when thrown by user code
+
+	// the position of the node the error came out of; zero until it has been located
+	Line   int
+	Column int
+
+	// the calls the error has been returned through, innermost first
+	Trace []Frame
+}
+
+type Frame struct {
+	Function string
+	Argument int // set when the error came out of an argument rather than the call, counting from 1
+	Line     int
+	Column   int
 }
 
-func (er *Error) Inspect() string  { return "ERROR: " + er.Message }
+func (er *Error) Inspect() string {
+	if er.Line == 0 {
+		return fmt.Sprintf("%s: %s", er.Kind, er.Message)
+	}
+	return fmt.Sprintf("%s at %d:%d: %s", er.Kind, er.Line, er.Column, er.Message)
+}
 func (er *Error) Type() ObjectType { return ERROR_OBJ }
 
+// Traceback describes the error followed by the calls it came out of
+func (er *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString(er.Inspect())
+	for i := 0; i < len(er.Trace); i++ {
+		frame := er.Trace[i]
+		if frame.Argument > 0 {
+			out.WriteString(fmt.Sprintf("\n  in argument %d of %s at %d:%d", frame.Argument, frame.Function, frame.Line, frame.Column))
+		} else {
+			out.WriteString(fmt.Sprintf("\n  in %s called at %d:%d", frame.Function, frame.Line, frame.Column))
+		}
+
+		// deep recursion would otherwise repeat the same frame thousands of times
+		repeated := 0
+		for i+1 < len(er.Trace) && er.Trace[i+1] == frame {
+			repeated++
+			i++
+		}
+		if repeated > 0 {
+			out.WriteString(fmt.Sprintf("\n  ... repeated %d more times", repeated))
+		}
+	}
+
+	return out.String()
+}
+
 // environment
 // functions
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Generator  bool // calls return a Generator rather than running the body
 }
 
 func (fn *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -106,23 +311,184 @@ func (fn *Function) Inspect() string {
 	return out.String()
 }
 
+// thunk, a delayed computation that is run at most once
+type Thunk struct {
+	Compute func() Object
+	value   Object
+}
+
+func (th *Thunk) Type() ObjectType { return THUNK_OBJ }
+func (th *Thunk) Inspect() string {
+	if th.value != nil {
+		return "thunk(" + th.value.Inspect() + ")"
+	}
+	return "thunk(...)"
+}
+
+// Force runs the computation on first use and remembers its result
+func (th *Thunk) Force() Object {
+	if th.value == nil {
+		th.value = th.Compute()
+		th.Compute = nil
+	}
+	return th.value
+}
+
+// generator, the suspended call of a function that yields
+type Generator struct {
+	Resume func() (Object, bool) // runs to the next yield, false once the call has returned
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// handle, the result of a spawned call
+type Handle struct {
+	done   chan struct{}
+	result Object
+}
+
+func NewHandle() *Handle {
+	return &Handle{done: make(chan struct{})}
+}
+
+func (h *Handle) Type() ObjectType { return HANDLE_OBJ }
+func (h *Handle) Inspect() string  { return "handle" }
+
+// Finish records the result of the call, releasing everyone waiting on it
+func (h *Handle) Finish(result Object) {
+	h.result = result
+	close(h.done)
+}
+
+// Wait blocks until the call has finished and returns its result
+func (h *Handle) Wait() Object {
+	<-h.done
+	return h.result
+}
+
+// enum, a named set of distinct constants
+type Enum struct {
+	Name     string
+	Variants []*EnumValue
+}
+
+func NewEnum(name string, variants []string) *Enum {
+	enum := &Enum{Name: name}
+	for i, variant := range variants {
+		enum.Variants = append(enum.Variants, &EnumValue{Enum: name, Name: variant, Ordinal: i})
+	}
+	return enum
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	variants := []string{}
+	for _, variant := range e.Variants {
+		variants = append(variants, variant.Name)
+	}
+	return "enum " + e.Name + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// Variant looks up a value by name
+func (e *Enum) Variant(name string) (*EnumValue, bool) {
+	for _, variant := range e.Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return nil, false
+}
+
+// each value exists once, so values compare by identity
+type EnumValue struct {
+	Enum    string
+	Name    string
+	Ordinal int
+}
+
+func (ev *EnumValue) Type() ObjectType { return ENUM_VALUE_OBJ }
+func (ev *EnumValue) Inspect() string  { return ev.Enum + "." + ev.Name }
+func (ev *EnumValue) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(ev.Inspect()))
+	return HashKey{Type: ev.Type(), Value: h.Sum64()}
+}
+
+// string builder, for building up long strings without copying them each
+// time something is added, as s = s + piece does
+type StringBuilder struct {
+	Builder strings.Builder
+}
+
+func (sb *StringBuilder) Type() ObjectType { return BUILDER_OBJ }
+func (sb *StringBuilder) Inspect() string  { return sb.Builder.String() }
+
+// regex, a compiled regular expression
+type Regex struct {
+	Value *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+func (r *Regex) Inspect() string  { return "regex(" + strconv.Quote(r.Value.String()) + ")" }
+
 // string
 type String struct {
 	Value string
+
+	// strings are immutable, so the key is only computed the first time it's needed
+	hashKey atomic.Pointer[HashKey]
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
+	if key := s.hashKey.Load(); key != nil {
+		return *key
+	}
+
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	key := HashKey{Type: s.Type(), Value: h.Sum64()}
+	s.hashKey.Store(&key)
+	return key
+}
+
+// bytes hold binary data that isn't necessarily valid UTF-8
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+func (b *Bytes) Inspect() string {
+	// anything but printable ASCII is shown as an escaped byte
+	var out strings.Builder
+	out.WriteString(`b"`)
+	for _, c := range b.Value {
+		switch {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "\\x%02x", c)
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
 }
 
 // builtin function
 type BuiltinFunction func(args ...Object) Object
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn  BuiltinFunction
+	Doc string // usage shown by editor tooling
+
+	// Allocated reports the bytes of new storage a call took, for evaluators
+	// that limit allocation. Without it, results that aren't one of the
+	// arguments are counted in full.
+	Allocated func(args []Object, result Object) int
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -131,8 +497,38 @@ func (b *Builtin) Inspect() string  { return "builtin function" }
 // array
 type Array struct {
 	Elements []Object
+
+	frozen atomic.Bool // see Freeze
+
+	// arrays made by Append share their storage; this is how much of it is in use
+	used *atomic.Int64
+}
+
+// Append returns a new array of the elements of ar followed by values, leaving
+// ar as it is. Arrays made by Append leave room to grow, and appending to the
+// longest array using that room fills it in rather than copying, so building
+// an array one element at a time takes amortized constant time per element.
+// Shorter arrays sharing the room never see what's past their own end.
+func (ar *Array) Append(values ...Object) *Array {
+	n := len(ar.Elements)
+	if ar.used != nil && cap(ar.Elements)-n >= len(values) && ar.used.CompareAndSwap(int64(n), int64(n+len(values))) {
+		return &Array{Elements: append(ar.Elements, values...), used: ar.used}
+	}
+
+	elements := make([]Object, n+len(values), max(2*(n+len(values)), 4))
+	copy(elements, ar.Elements)
+	copy(elements[n:], values)
+	used := new(atomic.Int64)
+	used.Store(int64(len(elements)))
+	return &Array{Elements: elements, used: used}
 }
 
+// Freeze marks the array as immutable, for builtins like push to refuse it.
+// It reports whether the array wasn't frozen already.
+func (ar *Array) Freeze() bool { return ar.frozen.CompareAndSwap(false, true) }
+
+func (ar *Array) Frozen() bool { return ar.frozen.Load() }
+
 func (ar *Array) Type() ObjectType { return ARRAY_OBJ }
 func (ar *Array) Inspect() string {
 	var out bytes.Buffer
@@ -153,26 +549,6 @@ func (ar *Array) Inspect() string {
 type Hashable interface {
 	HashKey() HashKey
 }
-type Hash struct {
-	Pairs map[HashKey]HashPair
-}
-
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-
-	pairs := []string{}
-	for _, v := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", v.Key.Inspect(), v.Value.Inspect()))
-	}
-
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-
-	return out.String()
-}
-
 type HashPair struct {
 	Key   Object
 	Value Object
@@ -182,3 +558,19 @@ type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
+
+// CompositeHashKey combines the keys of several values, e.g. the arguments of
+// a call, into one. It's false if any of the values isn't hashable.
+func CompositeHashKey(objs ...Object) (HashKey, bool) {
+	h := fnv.New64a()
+	for _, obj := range objs {
+		hashable, ok := obj.(Hashable)
+		if !ok {
+			return HashKey{}, false
+		}
+		key := hashable.HashKey()
+		h.Write(append([]byte(key.Type), 0))
+		binary.Write(h, binary.LittleEndian, key.Value)
+	}
+	return HashKey{Value: h.Sum64()}, true
+}
@@ -0,0 +1,236 @@
+package object
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	// the second call is served from the cache
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("cached hash key differs from the computed one")
+	}
+	if hello1.HashKey() == diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+// looking up the same key over and over, like a hash-heavy program does
+func BenchmarkStringHashKey(b *testing.B) {
+	key := &String{Value: strings.Repeat("monkey", 100)}
+	hash := map[HashKey]HashPair{key.HashKey(): {Key: key, Value: key}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = hash[key.HashKey()]
+	}
+}
+
+func BenchmarkUncachedStringHashKey(b *testing.B) {
+	value := strings.Repeat("monkey", 100)
+
+	for i := 0; i < b.N; i++ {
+		_ = (&String{Value: value}).HashKey()
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	for _, value := range []int64{-129, -128, 0, 1024, 1025, 1 << 40} {
+		integer := NewInteger(value)
+		if integer.Value != value {
+			t.Errorf("wrong value. expected=%d got=%d", value, integer.Value)
+		}
+		shared := NewInteger(value) == integer
+		if small := value >= -128 && value <= 1024; shared != small {
+			t.Errorf("%d should be shared: %t, got %t", value, small, shared)
+		}
+	}
+}
+
+// the results of arithmetic are mostly small integers
+func BenchmarkNewInteger(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = NewInteger(int64(i % 1000))
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash()
+	for _, key := range []string{"c", "a", "d", "b"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(len(key))})
+	}
+	hash.Set(&String{Value: "a"}, &Integer{Value: 5})
+	hash.Delete(&String{Value: "d"})
+
+	if hash.Inspect() != "{c: 1, a: 5, b: 1}" {
+		t.Errorf("hash doesn't keep insertion order. got=%s", hash.Inspect())
+	}
+	if pair, ok := hash.Get(&String{Value: "b"}); !ok || pair.Key.Inspect() != "b" {
+		t.Errorf("pairs after a deleted one should still be found. got=%v", pair)
+	}
+
+	copied := hash.Copy()
+	copied.Set(&String{Value: "e"}, &Integer{Value: 1})
+	if hash.Len() != 3 || copied.Len() != 4 {
+		t.Errorf("copies should be independent. got=%d and %d", hash.Len(), copied.Len())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	large, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	hash := NewHash()
+	hash.Set(&Integer{Value: 1}, &String{Value: "one"})
+	hash.Set(TRUE, &Array{Elements: []Object{NULL, &Float{Value: 1.5}}})
+	hash.Set(&String{Value: "big"}, &BigInt{Value: large})
+
+	tests := []Object{
+		NULL,
+		TRUE,
+		&Integer{Value: -42},
+		&Float{Value: 2},
+		&Decimal{Value: big.NewRat(-123, 100)},
+		&Bytes{Value: []byte{0, 0xff, 'a'}},
+		&String{Value: "héllo \"quoted\""},
+		&Array{Elements: []Object{}},
+		&Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{FALSE}}}},
+		hash,
+	}
+
+	for _, obj := range tests {
+		data, err := Marshal(obj)
+		if err != nil {
+			t.Fatalf("failed to marshal %s: %s", obj.Inspect(), err)
+		}
+		unmarshalled, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("failed to unmarshal %s: %s", data, err)
+		}
+		if unmarshalled.Type() != obj.Type() || unmarshalled.Inspect() != obj.Inspect() {
+			t.Errorf("value changed in a round trip. expected=%s got=%s", obj.Inspect(), unmarshalled.Inspect())
+		}
+	}
+
+	if unmarshalled, _ := Unmarshal([]byte(`{"type":"BOOLEAN","value":true}`)); unmarshalled != TRUE {
+		t.Errorf("booleans should unmarshal to the canonical TRUE")
+	}
+
+	if _, err := Marshal(&Array{Elements: []Object{&Function{}}}); err == nil || err.Error() != "cannot marshal FUNCTION" {
+		t.Errorf("functions shouldn't marshal. got=%v", err)
+	}
+	if _, err := Unmarshal([]byte(`{"type":"FUNCTION"}`)); err == nil {
+		t.Errorf("functions shouldn't unmarshal")
+	}
+}
+
+func TestEnvironmentSnapshot(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("global", &Integer{Value: 0})
+	env := NewEnclosedEnvironment(outer)
+	env.Set("x", &Integer{Value: 1})
+
+	snapshot := env.Snapshot()
+	env.Set("x", &Integer{Value: 2})
+	env.Set("y", &Integer{Value: 3})
+	env.Assign("global", &Integer{Value: 4})
+
+	env.Restore(snapshot)
+	if x, _ := env.Get("x"); x.Inspect() != "1" {
+		t.Errorf("x wasn't restored. got=%s", x.Inspect())
+	}
+	if _, ok := env.Get("y"); ok {
+		t.Errorf("y should be gone after restoring")
+	}
+	// outer environments aren't part of the snapshot
+	if global, _ := env.Get("global"); global.Inspect() != "4" {
+		t.Errorf("outer binding shouldn't be restored. got=%s", global.Inspect())
+	}
+
+	// a snapshot can be restored more than once
+	env.Set("x", &Integer{Value: 5})
+	env.Restore(snapshot)
+	if x, _ := env.Get("x"); x.Inspect() != "1" {
+		t.Errorf("x wasn't restored a second time. got=%s", x.Inspect())
+	}
+}
+
+func TestCompositeHashKey(t *testing.T) {
+	key := func(objs ...Object) HashKey {
+		key, ok := CompositeHashKey(objs...)
+		if !ok {
+			t.Fatalf("expected %v to be hashable", objs)
+		}
+		return key
+	}
+
+	if key(&Integer{Value: 1}, &String{Value: "a"}) != key(&Integer{Value: 1}, &String{Value: "a"}) {
+		t.Errorf("equal arguments have different keys")
+	}
+	if key(&Integer{Value: 1}, &Integer{Value: 2}) == key(&Integer{Value: 2}, &Integer{Value: 1}) {
+		t.Errorf("the order of the arguments should matter")
+	}
+	if key(&Integer{Value: 1}) == key(TRUE) {
+		t.Errorf("the types of the arguments should matter")
+	}
+	if key() == key(&Integer{Value: 0}) {
+		t.Errorf("the number of arguments should matter")
+	}
+	if _, ok := CompositeHashKey(&Integer{Value: 1}, &Array{}); ok {
+		t.Errorf("arrays aren't hashable")
+	}
+}
+
+func TestArrayAppend(t *testing.T) {
+	integers := func(values ...int64) []Object {
+		objs := []Object{}
+		for _, value := range values {
+			objs = append(objs, NewInteger(value))
+		}
+		return objs
+	}
+
+	a := &Array{Elements: integers(1)}
+	b := a.Append(integers(2)...)
+	c := b.Append(integers(3)...)
+	d := b.Append(integers(4, 5)...) // b has been appended to already, so this must not overwrite c
+	e := c.Append(integers(6)...)
+	f := a.Append()
+
+	tests := []struct {
+		array    *Array
+		expected string
+	}{
+		{a, "[1]"},
+		{b, "[1, 2]"},
+		{c, "[1, 2, 3]"},
+		{d, "[1, 2, 4, 5]"},
+		{e, "[1, 2, 3, 6]"},
+		{f, "[1]"},
+	}
+	for i, tt := range tests {
+		if tt.array.Inspect() != tt.expected {
+			t.Errorf("tests[%d]: expected %s, got %s", i, tt.expected, tt.array.Inspect())
+		}
+	}
+
+	// growing the longest array reuses its storage
+	if &c.Elements[0] != &e.Elements[0] {
+		t.Errorf("expected e to share the storage of c")
+	}
+}
+
+func BenchmarkArrayAppend(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		array := &Array{}
+		for j := int64(0); j < 1000; j++ {
+			array = array.Append(NewInteger(j))
+		}
+	}
+}
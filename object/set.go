@@ -0,0 +1,68 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+)
+
+// set, unordered membership of hashable values; kept in insertion order so
+// it prints predictably
+type Set struct {
+	keys     []HashKey
+	elements map[HashKey]Object
+}
+
+func NewSet() *Set {
+	return &Set{elements: make(map[HashKey]Object)}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range s.Elements() {
+		elements = append(elements, el.Inspect())
+	}
+
+	out.WriteString("set([")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("])")
+
+	return out.String()
+}
+
+func (s *Set) Add(value Hashable) {
+	key := value.HashKey()
+	if _, ok := s.elements[key]; ok {
+		return
+	}
+	s.keys = append(s.keys, key)
+	s.elements[key] = value.(Object)
+}
+
+func (s *Set) Has(value Hashable) bool {
+	_, ok := s.elements[value.HashKey()]
+	return ok
+}
+
+func (s *Set) Len() int {
+	return len(s.keys)
+}
+
+// Elements returns the members in the order they were added
+func (s *Set) Elements() []Object {
+	elements := make([]Object, 0, len(s.keys))
+	for _, key := range s.keys {
+		elements = append(elements, s.elements[key])
+	}
+	return elements
+}
+
+func (s *Set) Copy() *Set {
+	copied := NewSet()
+	for _, el := range s.Elements() {
+		copied.Add(el.(Hashable))
+	}
+	return copied
+}
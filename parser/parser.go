@@ -6,14 +6,19 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 // NOTE: the order encodes operator precedence!
 const (
 	_ int = iota // start with iota to give constants incrementing values
 	LOWEST
+	ASSIGN      // x = y
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	PIPE        // x |> f
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
@@ -22,16 +27,37 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PIPE:            PIPE,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
+	token.OPTIONAL_CHAIN:  INDEX,
+}
+
+// Precedence returns how tightly a built-in infix operator binds, or LOWEST
+// for tokens that aren't infix operators
+func Precedence(tt token.TokenType) int {
+	if precedence, ok := precedences[tt]; ok {
+		return precedence
+	}
+	return LOWEST
 }
 
 type (
@@ -43,31 +69,81 @@ type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []ParserError
+	panicking bool              // an error was reported in the current statement, later ones are likely caused by it
+	brackets  []token.TokenType // the brackets of any kind that are open at the current token
+	depth     int               // how many expressions are being parsed inside each other
+	comments  []*ast.Comment    // skipped over, for the program to keep
+	maxDepth  int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+	precedences    map[token.TokenType]int
+}
+
+// Operator describes an operator that isn't built into the language, e.g. `**`.
+// Infix operators bind with the given precedence, prefix operators bind like `-`.
+// Both are parsed into ordinary prefix and infix expressions.
+type Operator struct {
+	Literal    string
+	Prefix     bool
+	Precedence int
+}
+
+type Option func(*Parser)
+
+// DefaultMaxDepth is how deeply expressions may be nested by default
+const DefaultMaxDepth = 1000
+
+// WithMaxDepth limits how deeply expressions may be nested; parsing recurses
+// for every level, so deeply nested input could otherwise exhaust the stack
+func WithMaxDepth(depth int) Option {
+	return func(p *Parser) {
+		p.maxDepth = depth
+	}
 }
 
-func New(l *lexer.Lexer) *Parser {
+// WithOperators registers extra operators, so new syntax can be tried out
+// without changing the parser
+func WithOperators(operators ...Operator) Option {
+	return func(p *Parser) {
+		for _, op := range operators {
+			p.RegisterOperator(op)
+		}
+	}
+}
+
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		errors:      []ParserError{},
+		maxDepth:    DefaultMaxDepth,
+		precedences: make(map[token.TokenType]int),
+	}
+	for tt, precedence := range precedences {
+		p.precedences[tt] = precedence
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefixParseFn(token.IDENT, p.parseIdentifier)
 	p.registerPrefixParseFn(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixParseFn(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixParseFn(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParseFn(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefixParseFn(token.TRUE, p.parseBooleanExpression)
 	p.registerPrefixParseFn(token.FALSE, p.parseBooleanExpression)
 	p.registerPrefixParseFn(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefixParseFn(token.IF, p.parseIfExpression)
+	p.registerPrefixParseFn(token.WHILE, p.parseWhileExpression)
+	p.registerPrefixParseFn(token.TRY, p.parseTryExpression)
+	p.registerPrefixParseFn(token.DELAY, p.parseDelayExpression)
+	p.registerPrefixParseFn(token.YIELD, p.parseYieldExpression)
+	p.registerPrefixParseFn(token.SPAWN, p.parseSpawnExpression)
 	p.registerPrefixParseFn(token.FUNCTION, p.parseFunctionExpression)
 	p.registerPrefixParseFn(token.STRING, p.parseStringLiteral)
 	p.registerPrefixParseFn(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixParseFn(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefixParseFn(token.SPREAD, p.parseSpreadExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfixParseFn(token.SLASH, p.parseInfixExpression)
@@ -76,10 +152,27 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixParseFn(token.MINUS, p.parseInfixExpression)
 	p.registerInfixParseFn(token.GT, p.parseInfixExpression)
 	p.registerInfixParseFn(token.LT, p.parseInfixExpression)
+	p.registerInfixParseFn(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfixParseFn(token.LT_EQ, p.parseInfixExpression)
 	p.registerInfixParseFn(token.EQ, p.parseInfixExpression)
 	p.registerInfixParseFn(token.NOT_EQ, p.parseInfixExpression)
+	p.registerInfixParseFn(token.AND, p.parseInfixExpression)
+	p.registerInfixParseFn(token.OR, p.parseInfixExpression)
+	p.registerInfixParseFn(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfixParseFn(token.PLUS_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfixParseFn(token.MINUS_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfixParseFn(token.ASTERISK_ASSIGN, p.parseCompoundAssignExpression)
+	p.registerInfixParseFn(token.SLASH_ASSIGN, p.parseCompoundAssignExpression)
 	p.registerInfixParseFn(token.LPAREN, p.parseFunctionCall)
 	p.registerInfixParseFn(token.LBRACKET, p.parseIndexingExpression)
+	p.registerInfixParseFn(token.DOT, p.parseAccessExpression)
+	p.registerInfixParseFn(token.OPTIONAL_CHAIN, p.parseOptionalChain)
+	p.registerInfixParseFn(token.PIPE, p.parsePipeExpression)
+
+	// before any token is read, so the lexer knows about extra operators
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// initialize peek & cur
 	p.nextToken()
@@ -96,9 +189,47 @@ func (p *Parser) registerInfixParseFn(tt token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tt] = fn
 }
 
+// RegisterOperator adds an operator to the parser and its lexer. It must be
+// called before the parser reads the operator, which is easiest to get right
+// by passing WithOperators to New.
+func (p *Parser) RegisterOperator(op Operator) {
+	tt := token.TokenType(op.Literal)
+	lexer.WithOperators(op.Literal)(p.l)
+
+	if op.Prefix {
+		p.registerPrefixParseFn(tt, p.parsePrefixExpression)
+		return
+	}
+	p.registerInfixParseFn(tt, p.parseInfixExpression)
+	p.precedences[tt] = op.Precedence
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken, Text: p.peekToken.Literal})
+		p.peekToken = p.l.NextToken()
+	}
+
+	switch p.curToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		p.brackets = append(p.brackets, p.curToken.Type)
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		// a closing bracket also closes the brackets left open inside it
+		for i := len(p.brackets) - 1; i >= 0; i-- {
+			if p.brackets[i] == openingBrackets[p.curToken.Type] {
+				p.brackets = p.brackets[:i]
+				break
+			}
+		}
+	}
+}
+
+var openingBrackets = map[token.TokenType]token.TokenType{
+	token.RPAREN:   token.LPAREN,
+	token.RBRACKET: token.LBRACKET,
+	token.RBRACE:   token.LBRACE,
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -106,22 +237,83 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
+		depth := len(p.brackets)
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize(depth)
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
+	p.collectLexerErrors()
 	return program
 }
 
+// ParseExpression parses the input as a single expression, optionally followed
+// by a semicolon. Anything after the expression is reported as an error.
+func (p *Parser) ParseExpression() ast.Expression {
+	exp := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	if !p.panicking && !p.peekTokenIs(token.EOF) {
+		p.errorAt(p.peekToken, "unexpected %s after expression", p.peekToken.Type)
+	}
+
+	p.collectLexerErrors()
+	if len(p.errors) > 0 {
+		return nil
+	}
+	return exp
+}
+
+// ParseExpressionString parses src as a single expression
+func ParseExpressionString(src string) (ast.Expression, []ParserError) {
+	p := New(lexer.New(src))
+	exp := p.ParseExpression()
+	return exp, p.ParserErrors()
+}
+
+// lexer problems come first, as they usually explain the parser errors
+func (p *Parser) collectLexerErrors() {
+	lexerErrors := []ParserError{}
+	for _, msg := range p.l.Errors() {
+		lexerErrors = append(lexerErrors, ParserError{Message: msg})
+	}
+	p.errors = append(lexerErrors, p.errors...)
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -130,18 +322,43 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+		pattern := &ast.ArrayPattern{Token: p.curToken}
+		if pattern.Elements = p.parsePatternNames(token.RBRACKET); pattern.Elements == nil {
+			return nil
+		}
+		pattern.Rbracket = p.curToken
+		stmt.Pattern = pattern
+	} else if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		pattern := &ast.HashPattern{Token: p.curToken}
+		if pattern.Keys = p.parsePatternNames(token.RBRACE); pattern.Keys == nil {
+			return nil
+		}
+		pattern.Rbrace = p.curToken
+		stmt.Pattern = pattern
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
+	// let x; declares x without a value
 	if p.peekTokenIs(token.SEMICOLON) {
+		if stmt.Pattern != nil {
+			// there's nothing to destructure
+			p.peekError(token.ASSIGN)
+			return nil
+		}
 		p.nextToken()
-		return nil
+		return stmt
 	}
 
-	p.expectPeek(token.ASSIGN)
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
@@ -150,6 +367,61 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// fn name(params) { body }
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	function := &ast.FunctionLiteralExpression{Token: stmt.Token}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if function.Parameters = p.parsePatternNames(token.RPAREN); function.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	function.Body = p.parseBlockStatement()
+	markTailCalls(function.Body, true)
+	function.Generator = yields(function.Body)
+	stmt.Function = function
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// a comma-separated list of names, e.g. function parameters or the [a, b, c]
+// of a destructuring pattern; a trailing comma is allowed. Returns nil on error.
+func (p *Parser) parsePatternNames(end token.TokenType) []*ast.Identifier {
+	names := []*ast.Identifier{}
+	p.nextToken()
+
+	for !p.currTokenIs(end) {
+		if !p.currTokenIs(token.IDENT) {
+			p.errorAt(p.curToken, "expected identifier, got %s", p.curToken.Type)
+			return nil
+		}
+		names = append(names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.peekTokenIs(end) {
+			p.peekError(end)
+			return nil
+		}
+		p.nextToken()
+	}
+
+	return names
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
@@ -164,6 +436,42 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	if stmt.Variants = p.parsePatternNames(token.RBRACE); stmt.Variants == nil {
+		return nil
+	}
+	stmt.Rbrace = p.curToken
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -177,9 +485,16 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth += 1
+	defer func() { p.depth -= 1 }()
+	if p.depth > p.maxDepth {
+		p.errorAt(p.curToken, "expression too deeply nested")
+		return nil
+	}
+
 	parsePrefix := p.prefixParseFns[p.curToken.Type]
 	if parsePrefix == nil {
-		p.noPrefixParseError(p.curToken.Type)
+		p.noPrefixParseError(p.curToken)
 		return nil
 	}
 	leftExp := parsePrefix()
@@ -198,9 +513,8 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
-func (p *Parser) noPrefixParseError(t token.TokenType) {
-	msg := fmt.Sprintf("No prefix parse function found for %s", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseError(t token.Token) {
+	p.errorAt(t, "No prefix parse function found for %s", t.Type)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -215,6 +529,16 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return prefixExp
 }
 
+// ...array
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	spread.Value = p.parseExpression(PREFIX)
+
+	return spread
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	infixExpression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -230,6 +554,45 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return infixExpression
 }
 
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.errorAt(p.curToken, "cannot assign to %s", left.String())
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: p.curToken, Name: name}
+
+	// assignment is right-associative: a = b = c is a = (b = c)
+	p.nextToken()
+	exp.Value = p.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
+// x += y is desugared into x = x + y
+func (p *Parser) parseCompoundAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.errorAt(p.curToken, "cannot assign to %s", left.String())
+		return nil
+	}
+
+	operator := strings.TrimSuffix(p.curToken.Literal, "=")
+	assignToken := token.Token{Type: token.ASSIGN, Literal: "=", Line: p.curToken.Line, Column: p.curToken.Column}
+	operatorToken := token.Token{Type: token.TokenType(operator), Literal: operator, Line: p.curToken.Line, Column: p.curToken.Column}
+
+	p.nextToken()
+	value := &ast.InfixExpression{
+		Token:    operatorToken,
+		Left:     name,
+		Operator: operator,
+		Right:    p.parseExpression(ASSIGN - 1),
+	}
+
+	return &ast.AssignExpression{Token: assignToken, Name: name, Value: value}
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -239,8 +602,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
 	if err != nil {
-		msg := fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, "Could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -248,6 +610,19 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return stmt
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	exp := &ast.FloatLiteral{Token: p.curToken}
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+
+	if err != nil {
+		p.errorAt(p.curToken, "Could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+
+	exp.Value = value
+	return exp
+}
+
 func (p *Parser) parseBooleanExpression() ast.Expression {
 	return &ast.BooleanExpression{Token: p.curToken, Value: p.currTokenIs(token.TRUE)}
 }
@@ -295,39 +670,166 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Handler = p.parseBlockStatement()
+
+	return exp
+}
+
+func (p *Parser) parseDelayExpression() ast.Expression {
+	exp := &ast.DelayExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	exp.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	exp.Rparen = p.curToken
+
+	return exp
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	exp := &ast.YieldExpression{Token: p.curToken}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	exp := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+	call, ok := p.parseExpression(PREFIX).(*ast.FunctionCallExpression)
+	if !ok {
+		p.errorAt(exp.Token, "spawn expects a function call")
+		return nil
+	}
+	exp.Call = call
+
+	return exp
+}
+
+func (p *Parser) parseWhileExpression() ast.Expression {
+	exp := &ast.WhileExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	exp.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Body = p.parseBlockStatement()
+
+	return exp
+}
+
 func (p *Parser) parseFunctionExpression() ast.Expression {
 	exp := &ast.FunctionLiteralExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	p.nextToken()
-	exp.Parameters = p.parseFunctionParameters()
+	if exp.Parameters = p.parsePatternNames(token.RPAREN); exp.Parameters == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 	exp.Body = p.parseBlockStatement()
+	markTailCalls(exp.Body, true)
+	exp.Generator = yields(exp.Body)
 	return exp
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	parameters := []*ast.Identifier{}
+// marks the calls whose value is returned from the function as is: returned
+// calls, and calls that end the body, including through if-expressions.
+// Calls inside try bodies are never marked, as the handler must still run.
+func markTailCalls(block *ast.BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
 
-	for !p.currTokenIs(token.RPAREN) {
-		idnt, ok := p.parseIdentifier().(*ast.Identifier)
-		if !ok {
-			return nil
-		}
-		parameters = append(parameters, idnt)
+	for i, stmt := range block.Statements {
+		last := tail && i == len(block.Statements)-1
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue, true)
+		case *ast.ExpressionStatement:
+			markTailExpression(stmt.Expression, last)
+		case *ast.LetStatement:
+			markTailExpression(stmt.Value, false)
 		}
-		p.nextToken()
 	}
+}
 
-	return parameters
+// only descends into blocks, where return statements may be nested
+func markTailExpression(exp ast.Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *ast.FunctionCallExpression:
+		exp.Tail = tail
+	case *ast.IfExpression:
+		markTailCalls(exp.Consequence, tail)
+		markTailCalls(exp.Alternative, tail)
+	case *ast.WhileExpression:
+		markTailCalls(exp.Body, false)
+	}
+}
+
+// a function yields if its own body does, not counting nested functions
+func yields(body *ast.BlockStatement) bool {
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.YieldExpression:
+			found = true
+		case *ast.FunctionLiteralExpression:
+			return false
+		}
+		return !found
+	})
+	return found
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -337,12 +839,19 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
+		depth := len(p.brackets)
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			if p.synchronize(depth) {
+				// the broken statement ran into the end of the block
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken
 
 	return block
 }
@@ -350,24 +859,32 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 func (p *Parser) parseFunctionCall(expr ast.Expression) ast.Expression {
 	exp := &ast.FunctionCallExpression{Token: p.curToken, Function: expr}
 
-	p.nextToken()
-	exp.Parameters = p.parseFunctionCallParameters()
+	if exp.Parameters = p.parseExpressionList(token.RPAREN); exp.Parameters == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
 	return exp
 }
 
-func (p *Parser) parseFunctionCallParameters() []ast.Expression {
-	parameters := []ast.Expression{}
+// a comma-separated list of expressions up to the end token, e.g. call
+// arguments or array elements; a trailing comma is allowed. Returns nil on error.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
 
-	for !p.currTokenIs(token.RPAREN) {
-		parameters = append(parameters, p.parseExpression(LOWEST))
+	for !p.peekTokenIs(end) {
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
+		if !p.peekTokenIs(token.COMMA) {
+			break
 		}
 		p.nextToken()
 	}
 
-	return parameters
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
@@ -376,49 +893,116 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	exp := &ast.ArrayLiteral{Token: p.curToken}
-	elements := []ast.Expression{}
+
+	if exp.Elements = p.parseExpressionList(token.RBRACKET); exp.Elements == nil {
+		return nil
+	}
+	exp.Rbracket = p.curToken
+
+	return exp
+}
+
+// arr[i], or the slice arr[start:end]
+func (p *Parser) parseIndexingExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if !p.peekTokenIs(token.COLON) {
+		p.expectPeek(token.RBRACKET)
+		return &ast.IndexingExpression{Token: tok, Target: left, Index: index, Rbracket: p.curToken}
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Target: left, Start: index}
 	p.nextToken()
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		slice.Stop = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	slice.Rbracket = p.curToken
 
-	for !p.currTokenIs(token.RBRACKET) {
-		elements = append(elements, p.parseExpression(LOWEST))
+	return slice
+}
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
+// x |> f(y) is rewritten into the call f(x, y), and x |> f into f(x)
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	p.nextToken()
+	right := p.parseExpression(PIPE)
+
+	if call, ok := right.(*ast.FunctionCallExpression); ok {
+		call.Parameters = append([]ast.Expression{left}, call.Parameters...)
+		return call
+	}
+	return &ast.FunctionCallExpression{Token: tok, Function: right, Parameters: []ast.Expression{left}}
+}
+
+// target?.key or target?.[index]
+func (p *Parser) parseOptionalChain(left ast.Expression) ast.Expression {
+	if !p.peekTokenIs(token.LBRACKET) {
+		exp, ok := p.parseAccessExpression(left).(*ast.AccessExpression)
+		if !ok {
+			return nil
 		}
-		p.nextToken()
+		exp.Optional = true
+		return exp
 	}
-	exp.Elements = elements
 
+	tok := p.curToken
+	p.nextToken()
+	exp, ok := p.parseIndexingExpression(left).(*ast.IndexingExpression)
+	if !ok {
+		p.errorAt(tok, "slices can't be optional")
+		return nil
+	}
+	exp.Optional = true
 	return exp
 }
 
-func (p *Parser) parseIndexingExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexingExpression{Token: p.curToken, Target: left}
+func (p *Parser) parseAccessExpression(left ast.Expression) ast.Expression {
+	exp := &ast.AccessExpression{Token: p.curToken, Target: left}
 
-	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
-	p.expectPeek(token.RBRACKET)
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Key = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	return exp
 }
 
+// {key: value, ...}, a trailing comma is allowed
 func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Token: p.curToken, Pairs: make(map[ast.Expression]ast.Expression)}
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []ast.HashPair{}}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		key := p.parseExpression(LOWEST)
 
-		p.expectPeek(token.COLON)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
+		if !p.peekTokenIs(token.COMMA) {
+			break
 		}
+		p.nextToken()
 	}
-	p.nextToken()
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
 
 	return hash
 }
@@ -442,26 +1026,111 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
+	if precedence, ok := p.precedences[p.curToken.Type]; ok {
+		return precedence
 	}
 
 	return LOWEST
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
+	if precedence, ok := p.precedences[p.peekToken.Type]; ok {
+		return precedence
 	}
 
 	return LOWEST
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("unexpected next token expected=%s got=%s", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, ParserError{
+		Pos:      p.peekToken.Pos(),
+		Expected: t,
+		Actual:   p.peekToken.Type,
+		Message:  fmt.Sprintf("unexpected next token expected=%s got=%s", t, p.peekToken.Type),
+	})
+}
+
+func (p *Parser) errorAt(tok token.Token, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, ParserError{
+		Pos:     tok.Pos(),
+		Actual:  tok.Type,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// after an error, skips to the end of the statement it occurred in, so that
+// parsing picks up again at the next statement rather than reporting errors
+// caused by the first one. The statement ends at a semicolon, line break or
+// keyword outside of the brackets it opened; a keyword also ends it when a
+// ( or [ was left unclosed. Reports whether the skipped tokens closed the
+// enclosing block.
+func (p *Parser) synchronize(depth int) bool {
+	defer func() { p.panicking = false }()
+
+	for !p.currTokenIs(token.EOF) {
+		open := len(p.brackets)
+		if open < depth {
+			return true
+		}
+
+		if open == depth && (p.currTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) ||
+			startsStatement(p.peekToken.Type) || p.peekToken.Line > p.curToken.Line) {
+			return false
+		}
+		if open > depth && p.brackets[open-1] != token.LBRACE && startsStatement(p.peekToken.Type) {
+			p.brackets = p.brackets[:depth]
+			return false
+		}
+
+		p.nextToken()
+	}
+	return false
 }
 
+func startsStatement(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.THROW, token.ENUM, token.BREAK, token.CONTINUE:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParserError describes a problem with the program being parsed. Problems
+// reported by the lexer only have a message.
+type ParserError struct {
+	Pos      token.Position
+	Expected token.TokenType // set when a specific token was expected
+	Actual   token.TokenType // the offending token
+	Message  string
+}
+
+// Error prefixes the message with the position of the offending token
+func (e ParserError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Message
+	}
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Errors returns the problems found while parsing as strings
 func (p *Parser) Errors() []string {
+	errors := []string{}
+	for _, err := range p.errors {
+		errors = append(errors, err.Error())
+	}
+	return errors
+}
+
+// ParserErrors returns the problems found while parsing
+func (p *Parser) ParserErrors() []ParserError {
 	return p.errors
 }
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -56,6 +58,119 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestLetWithoutValue(t *testing.T) {
+	p := New(lexer.New("let x; x"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(program.Statements))
+	}
+	if !testLetStatement(t, program.Statements[0], "x") {
+		return
+	}
+	if value := program.Statements[0].(*ast.LetStatement).Value; value != nil {
+		t.Errorf("Expected no value, got %s", value.String())
+	}
+	if program.Statements[0].String() != "let x;" {
+		t.Errorf("Unexpected string. got=%q", program.Statements[0].String())
+	}
+
+	p = New(lexer.New("let [a, b];"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != "1:11: unexpected next token expected== got=;" {
+		t.Errorf("Unexpected parser errors. got=%q", errors)
+	}
+}
+
+func TestLetArrayDestructuring(t *testing.T) {
+	input := "let [a, b, c] = [1, 2, 3];"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("statement is not an ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	pattern, ok := stmt.Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("pattern is not an ast.ArrayPattern. got=%T", stmt.Pattern)
+	}
+
+	expectedNames := []string{"a", "b", "c"}
+	if len(pattern.Elements) != len(expectedNames) {
+		t.Fatalf("Unexpected number of names. expected=%d got=%d", len(expectedNames), len(pattern.Elements))
+	}
+	for i, name := range pattern.Elements {
+		testIdentifier(t, name, expectedNames[i])
+	}
+
+	expected := "let [a,b,c] = [1,2,3];"
+	if program.String() != expected {
+		t.Errorf("Parsing result is unexpected. wanted=%q got=%q", expected, program.String())
+	}
+
+	for _, input := range []string{"let [a, 1] = x;", "let [a b] = x;"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("Expected a parser error for %q", input)
+		}
+	}
+}
+
+func TestLetHashDestructuring(t *testing.T) {
+	input := "let {name, age} = person;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("statement is not an ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	pattern, ok := stmt.Pattern.(*ast.HashPattern)
+	if !ok {
+		t.Fatalf("pattern is not an ast.HashPattern. got=%T", stmt.Pattern)
+	}
+
+	expectedKeys := []string{"name", "age"}
+	if len(pattern.Keys) != len(expectedKeys) {
+		t.Fatalf("Unexpected number of keys. expected=%d got=%d", len(expectedKeys), len(pattern.Keys))
+	}
+	for i, key := range pattern.Keys {
+		testIdentifier(t, key, expectedKeys[i])
+	}
+
+	expected := "let {name,age} = person;"
+	if program.String() != expected {
+		t.Errorf("Parsing result is unexpected. wanted=%q got=%q", expected, program.String())
+	}
+
+	for _, input := range []string{`let {"name"} = x;`, "let {name age} = x;"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("Expected a parser error for %q", input)
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("token literal is not 'let'. got=%q", s.TokenLiteral())
@@ -81,6 +196,40 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	return true
 }
 
+func TestEnumStatement(t *testing.T) {
+	input := "enum Color { Red, Green, Blue }; Color.Red"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected two statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.EnumStatement)
+	if !ok {
+		t.Fatalf("statement is not an ast.EnumStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Name, "Color")
+
+	expectedVariants := []string{"Red", "Green", "Blue"}
+	if len(stmt.Variants) != len(expectedVariants) {
+		t.Fatalf("Unexpected number of variants. expected=%d got=%d", len(expectedVariants), len(stmt.Variants))
+	}
+	for i, variant := range stmt.Variants {
+		testIdentifier(t, variant, expectedVariants[i])
+	}
+
+	for _, input := range []string{"enum { A }", "enum E { A, 1 }", "enum E A"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("Expected a parser error for %q", input)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -233,6 +382,34 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statement is not an expression. Got %T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("Not a FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("Value incorrect. wanted=%f got=%f", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("TokenLiteral incorrect. wanted=%q got=%q", "3.25", literal.TokenLiteral())
+	}
+}
+
 func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
 	switch v := expected.(type) {
 	case int:
@@ -324,8 +501,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 / 5", 5, "/", 5},
 		{"5 > 5", 5, ">", 5},
 		{"5 < 5", 5, "<", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"5 <= 5", 5, "<=", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
+		{"true && false", true, "&&", false},
+		{"false || true", false, "||", true},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -475,6 +656,102 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a + b <= c * d == true",
+			"(((a + b) <= (c * d)) == true)",
+		},
+		// logical operators
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a == b && c != d || e",
+			"(((a == b) && (c != d)) || e)",
+		},
+		{
+			"x = a && b",
+			"x = (a && b)",
+		},
+		// delay
+		{
+			"delay(a + b) + 1",
+			"(delay((a + b)) + 1)",
+		},
+		// spawn
+		{
+			"spawn f(x) + 1",
+			"(spawn f(x) + 1)",
+		},
+		{
+			"wait(spawn a.b(1))",
+			"wait(spawn a.b(1))",
+		},
+		// slicing
+		{
+			"a[1:b + 1]",
+			"a[1:(b + 1)]",
+		},
+		{
+			"a[:2][1:] + s[:]",
+			"(a[:2][1:] + s[:])",
+		},
+		// dot access
+		{
+			"a.b.c",
+			"a.b.c",
+		},
+		{
+			"-a.b * c",
+			"((-a.b) * c)",
+		},
+		{
+			"a.b[0] + f(x).y",
+			"(a.b[0] + f(x).y)",
+		},
+		{
+			"a.b(1).c()",
+			"a.b(1).c()",
+		},
+		// pipe
+		{
+			"x |> f |> g(2)",
+			"g(f(x),2)",
+		},
+		{
+			"y = a + 1 |> f",
+			"y = f((a + 1))",
+		},
+		{
+			"x |> len == 3 && ok",
+			"((len(x) == 3) && ok)",
+		},
+		{
+			"x |> fn(a) { a } |> h",
+			"h(fn(a)a(x))",
+		},
+		// optional chaining
+		{
+			"a?.b?.c.d",
+			"a?.b?.c.d",
+		},
+		{
+			"-a?.[i + 1] * b",
+			"((-a?.[(i + 1)]) * b)",
+		},
+		{
+			"a?.f(1)",
+			"a?.f(1)",
+		},
+		// spread
+		{
+			"add(...a, -b)",
+			"add(...a,(-b))",
+		},
+		{
+			"[1, ...f(x)[0]]",
+			"[1,...f(x)[0]]",
+		},
 	}
 
 	for _, tt := range tests {
@@ -490,6 +767,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "x = 5"},
+		{"x = x + 1;", "x = (x + 1)"},
+		{"x = y = 2 * 3;", "x = y = (2 * 3)"},
+		{"x += 1;", "x = (x + 1)"},
+		{"x -= 2 * 3;", "x = (x - (2 * 3))"},
+		{"x *= y /= 2;", "x = (x * y = (y / 2))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Statement is not an expression. Got %T", program.Statements[0])
+		}
+
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("Expression is not an AssignExpression. Got %T", stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("Parsing result is unexpected. wanted=%q got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("5 = 2;"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("Expected an error assigning to a literal")
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x }`
 	l := lexer.New(input)
@@ -601,6 +922,97 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestTryExpression(t *testing.T) {
+	input := `try { throw "boom"; } catch (e) { e }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statement is not an expression. Got %T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("Statement is not a TryExpression. Got %T", stmt.Expression)
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("Expected a single body statement, got %d", len(exp.Body.Statements))
+	}
+	throw, ok := exp.Body.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("Body statement is not a ThrowStatement. Got %T", exp.Body.Statements[0])
+	}
+	if !testStringLiteral(t, throw.Value, "boom") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Param, "e") {
+		return
+	}
+
+	handler, ok := exp.Handler.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Handler is not an ExpressionStatement. Got %T", exp.Handler.Statements[0])
+	}
+	if !testIdentifier(t, handler.Expression, "e") {
+		return
+	}
+
+	for _, input := range []string{"try { 1 }", "try { 1 } catch { 2 }", "try { 1 } catch (1) { 2 }"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("Expected a parser error for %q", input)
+		}
+	}
+}
+
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected a single statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statement is not an expression. Got %T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("Statement is not a WhileExpression. Got %T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(exp.Body.Statements) != 2 {
+		t.Fatalf("Expected two body statements, got %d", len(exp.Body.Statements))
+	}
+	if _, ok := exp.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("Second statement is not a ContinueStatement. Got %T", exp.Body.Statements[1])
+	}
+
+	expected := "while (x < 10) if (x == 5) break;continue;"
+	if program.String() != expected {
+		t.Errorf("Parsing result is unexpected. wanted=%q got=%q", expected, program.String())
+	}
+}
+
 func TestFunctionLiteralExpression(t *testing.T) {
 	input := `fn (x, y) { x + y }`
 	l := lexer.New(input)
@@ -646,6 +1058,89 @@ func TestFunctionLiteralExpression(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionStatement(t *testing.T) {
+	input := `fn add(x, y) { x + y }; add(1, 2)`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected two statements, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("Statement is not a FunctionStatement. Got %T", program.Statements[0])
+	}
+
+	testIdentifier(t, stmt.Name, "add")
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("Expected two parameters, got=%d", len(stmt.Function.Parameters))
+	}
+
+	expected := "fn add(x,y)(x + y)add(1,2)"
+	if program.String() != expected {
+		t.Errorf("Parsing result is unexpected. wanted=%q got=%q", expected, program.String())
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	input := `fn f(n) {
+		a(n);
+		if (n) { return b(n) };
+		let x = c(n);
+		while (x) { d(x); return e(x) };
+		try { g(n) } catch (err) { h(err) };
+		if (n) { i(n) } else { j(n) + k(n) }
+	}`
+
+	program := New(lexer.New(input)).ParseProgram()
+
+	tail := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if call, ok := node.(*ast.FunctionCallExpression); ok {
+			tail[call.Function.String()] = call.Tail
+		}
+		return true
+	})
+
+	expected := map[string]bool{
+		"a": false, "b": true, "c": false, "d": false, "e": true,
+		"g": false, "h": false, "i": true, "j": false, "k": false,
+	}
+	for name, want := range expected {
+		if tail[name] != want {
+			t.Errorf("Unexpected tail marking for %s. expected=%t got=%t", name, want, tail[name])
+		}
+	}
+}
+
+func TestGeneratorFunctions(t *testing.T) {
+	tests := []struct {
+		input     string
+		generator bool
+	}{
+		{"fn() { yield 1 }", true},
+		{"fn() { if (x) { let y = yield x; } }", true},
+		{"fn() { fn() { yield 1 } }", false},
+		{"fn() { 1 }", false},
+	}
+
+	for _, tt := range tests {
+		program := New(lexer.New(tt.input)).ParseProgram()
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteralExpression)
+		if !ok {
+			t.Fatalf("Expression is not a FunctionLiteralExpression. Got %T", stmt.Expression)
+		}
+		if function.Generator != tt.generator {
+			t.Errorf("Unexpected generator flag for %q. expected=%t got=%t", tt.input, tt.generator, function.Generator)
+		}
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -823,8 +1318,9 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("expression is not an HashLiteral. got=%T (%+v)", stmt.Expression, stmt.Expression)
 	}
 
-	for k, v := range exp.Pairs {
-		switch k := k.(type) {
+	for _, pair := range exp.Pairs {
+		v := pair.Value
+		switch k := pair.Key.(type) {
 		case *ast.BooleanExpression:
 			if k.Value != true {
 				t.Fatalf("incorrect key. expected=%t got=%t", true, k.Value)
@@ -896,3 +1392,352 @@ func TestEmptyHashLiterals(t *testing.T) {
 		t.Fatalf("Expected an empty hash length got=%d", len(exp.Pairs))
 	}
 }
+
+func TestSpawnRequiresCall(t *testing.T) {
+	for _, input := range []string{"spawn f", "spawn f(1)[0]", "spawn 1"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != "1:1: spawn expects a function call" {
+			t.Errorf("Unexpected parser errors for %q. got=%v", input, errors)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;\nlet = 1;", "2:5: unexpected next token expected=IDENT got=="},
+		{"let x = (1 + 2;", "1:15: unexpected next token expected=) got=;"},
+		{"if (x) {\n  )\n}", "2:3: No prefix parse function found for )"},
+		{"1 = 2", "1:3: cannot assign to 1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("Unexpected parser errors for %q. expected=%q got=%q", tt.input, tt.expected, errors)
+		}
+	}
+
+	p := New(lexer.NewFile("script.mky", "let x = ;"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) == 0 || errors[0] != "script.mky:1:9: No prefix parse function found for ;" {
+		t.Errorf("Unexpected parser errors. got=%q", errors)
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1,2,3]"},
+		{"{\"a\": 1,}", "{a: 1}"},
+		{"fn(a, b,) { a }", "fn(a,b)a"},
+		{"add(1, 2,)", "add(1,2)"},
+		{"add(\n  1,\n  2,\n)", "add(1,2)"},
+		{"let [a, b,] = x;", "let [a,b] = x;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("Unexpected program for %q. expected=%q got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"[,]", "add(1,,)", "fn(,) {}", "{,}"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("Expected a parser error for %q", input)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let = 5;
+let y = ;
+let z = {1: 2 3: 4};
+fn f(a, b) {
+  let q = [1, 2;
+  return a +;
+}
+if (z) { puts(1 2) }
+let ok = 1;
+puts(ok)`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	expected := []string{
+		"1:5: unexpected next token expected=IDENT got==",
+		"2:9: No prefix parse function found for ;",
+		"3:15: unexpected next token expected=} got=INT",
+		"5:16: unexpected next token expected=] got=;",
+		"6:13: No prefix parse function found for ;",
+		"8:17: unexpected next token expected=) got=INT",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%q got=%q", expected, errors)
+	}
+	for i, err := range errors {
+		if err != expected[i] {
+			t.Errorf("errors[%d] wrong. expected=%q got=%q", i, expected[i], err)
+		}
+	}
+
+	// statements that failed to parse are left out
+	if program.String() != "fn f(a,b)if z let ok = 1;puts(ok)" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	p := New(lexer.New("let x = (1;\n/* open"))
+	p.ParseProgram()
+
+	expected := []ParserError{
+		{Message: "unterminated block comment starting at 2:1"},
+		{Pos: token.Position{Line: 1, Column: 11}, Expected: token.RPAREN, Actual: token.SEMICOLON, Message: "unexpected next token expected=) got=;"},
+	}
+
+	errors := p.ParserErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d got=%d (%+v)", len(expected), len(errors), errors)
+	}
+	for i, err := range errors {
+		if err != expected[i] {
+			t.Errorf("errors[%d] wrong. expected=%+v got=%+v", i, expected[i], err)
+		}
+	}
+
+	if got := p.Errors()[1]; got != "1:11: unexpected next token expected=) got=;" {
+		t.Errorf("wrong error string. got=%q", got)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, [2, 3][0]);
+"hi" |> len;
+{"a": 1}["a"];`
+
+	program := New(lexer.New(input)).ParseProgram()
+	if len(program.Statements) != 4 {
+		t.Fatalf("expected 4 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionCallExpression)
+	piped := program.Statements[2].(*ast.ExpressionStatement).Expression
+	indexing := program.Statements[3].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node ast.Node
+		pos  string
+		end  string
+	}{
+		{program, "1:1", "6:14"},
+		{let, "1:1", "3:2"},
+		{let.Value, "1:11", "3:2"},
+		{let.Value.(*ast.FunctionLiteralExpression).Body.Statements[0], "2:3", "2:8"},
+		{call, "4:1", "4:18"},
+		{call.Parameters[1], "4:8", "4:17"},
+		{piped, "5:1", "5:12"},
+		{indexing, "6:1", "6:14"},
+	}
+
+	for _, tt := range tests {
+		if pos := tt.node.Pos().String(); pos != tt.pos {
+			t.Errorf("wrong start for %q. expected=%s got=%s", tt.node.String(), tt.pos, pos)
+		}
+		if end := tt.node.End().String(); end != tt.end {
+			t.Errorf("wrong end for %q. expected=%s got=%s", tt.node.String(), tt.end, end)
+		}
+	}
+}
+
+func TestLexerErrorsAreReported(t *testing.T) {
+	l := lexer.New("let x = 5; /* unterminated")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Expected a single error, got %d: %v", len(errors), errors)
+	}
+	if errors[0] != "unterminated block comment starting at 1:12" {
+		t.Errorf("Unexpected error. got=%q", errors[0])
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))", ""},
+		{"add(a, b);", "add(a,b)", ""},
+		{"fn(x) { x }", "fn(x)x", ""},
+		{"1 + 2 3", "", "1:7: unexpected INT after expression"},
+		{"let x = 1;", "", "1:1: No prefix parse function found for LET"},
+		{"", "", "1:1: No prefix parse function found for EOF"},
+	}
+
+	for _, tt := range tests {
+		exp, errs := ParseExpressionString(tt.input)
+		if tt.err != "" {
+			if len(errs) == 0 || errs[0].Error() != tt.err {
+				t.Errorf("wrong errors for %q. expected=%q got=%v", tt.input, tt.err, errs)
+			}
+			if exp != nil {
+				t.Errorf("expected no expression for %q, got %s", tt.input, exp.String())
+			}
+			continue
+		}
+		if len(errs) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, errs)
+			continue
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("wrong expression for %q. expected=%q got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestWithOperators(t *testing.T) {
+	operators := WithOperators(
+		Operator{Literal: "**", Precedence: PREFIX},
+		Operator{Literal: "<>", Precedence: EQUALS},
+		Operator{Literal: "~", Prefix: true},
+	)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 ** 2", "(2 * (3 ** 2))"},
+		{"2 ** 3 * 2", "((2 ** 3) * 2)"},
+		{"a + b <> c", "((a + b) <> c)"},
+		{"~a ** b", "((~a) ** b)"},
+		{"a * b", "(a * b)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), operators)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	// other parsers don't know about the operators
+	p := New(lexer.New("2 ** 3"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected errors parsing an unregistered operator")
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  []Option
+		err   string
+	}{
+		{strings.Repeat("(", 10000) + "1" + strings.Repeat(")", 10000), nil, "1:1001: expression too deeply nested"},
+		{strings.Repeat("!", 10000) + "true", nil, "1:1001: expression too deeply nested"},
+		{"[[[1]]]", []Option{WithMaxDepth(3)}, "1:4: expression too deeply nested"},
+		{"fn() { fn() { 1 } }", []Option{WithMaxDepth(2)}, "1:15: expression too deeply nested"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), tt.opts...)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected a single error, got %d: %v", len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.err {
+			t.Errorf("wrong error. expected=%q got=%q", tt.err, errors[0])
+		}
+	}
+
+	p := New(lexer.New("[[1]]"), WithMaxDepth(3))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestHashLiteralOrder(t *testing.T) {
+	input := `{"z": 1, "a": 2, 10: 3, true: 4, "m": 5}`
+
+	for i := 0; i < 10; i++ {
+		exp, errs := ParseExpressionString(input)
+		if len(errs) != 0 {
+			t.Fatalf("parser errors: %v", errs)
+		}
+
+		expected := `{z: 1,a: 2,10: 3,true: 4,m: 5}`
+		if exp.String() != expected {
+			t.Fatalf("pairs out of order. expected=%q got=%q", expected, exp.String())
+		}
+
+		hash := exp.(*ast.HashLiteral)
+		value, ok := hash.Get(&ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "10"}, Value: 10})
+		if !ok || value.String() != "3" {
+			t.Errorf("wrong value for 10. got=%v (%t)", value, ok)
+		}
+		if _, ok := hash.Get(&ast.Identifier{Value: "missing"}); ok {
+			t.Errorf("expected no value for a missing key")
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// one
+let x = 1; /* two */
+fn f() {
+	// three
+}`
+	p := New(lexer.New(input, lexer.WithComments()))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(program.Statements))
+	}
+	expected := []string{"// one", "/* two */", "// three"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d", len(expected), len(program.Comments))
+	}
+	for i, comment := range program.Comments {
+		if comment.Text != expected[i] {
+			t.Errorf("comments[%d]: expected %q, got %q", i, expected[i], comment.Text)
+		}
+	}
+
+	// without the lexer option there are no comment tokens to keep
+	program = New(lexer.New(input)).ParseProgram()
+	if len(program.Comments) != 0 {
+		t.Errorf("Expected no comments, got %d", len(program.Comments))
+	}
+}
@@ -2,46 +2,138 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/diagnostics"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"os"
+	"os/signal"
+	"strings"
 )
 
 const PROMPT = "🐵 "
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	// shared with the evaluator, so `input()` reads the lines that follow
+	reader := bufio.NewReader(in)
 	env := object.NewEnvironment()
+	eval := evaluator.New(evaluator.WithInput(reader), evaluator.WithOutput(out))
+
+	// lines are numbered across the session, so errors in functions defined
+	// on earlier lines can point at them
+	history := []string{}
+
+	// the bindings from before each line that was run, for :undo
+	snapshots := []*object.Snapshot{}
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		line = strings.TrimRight(line, "\r\n")
+		history = append(history, line)
+
+		// :trace on logs every node evaluated, until :trace off
+		switch line {
+		case ":trace on":
+			eval.SetTrace(out)
+			continue
+		case ":trace off":
+			eval.SetTrace(nil)
+			continue
+		case ":undo":
+			// takes back the bindings made by the last line that was run
+			if len(snapshots) == 0 {
+				io.WriteString(out, "nothing to undo\n")
+				continue
+			}
+			env.Restore(snapshots[len(snapshots)-1])
+			snapshots = snapshots[:len(snapshots)-1]
+			continue
+		}
+
+		// :reload <file> runs the definitions in the file that changed since it was last reloaded
+		if file, ok := strings.CutPrefix(line, ":reload "); ok {
+			reload(out, eval, env, strings.TrimSpace(file))
+			continue
+		}
+
+		// :ast <code> shows the syntax tree of the code instead of running it
+		source, showAST := strings.CutPrefix(line, ":ast ")
+		if showAST {
+			// blanked out, so columns still match the line
+			source = strings.Repeat(" ", len(":ast ")) + source
+		}
+
+		l := lexer.New(source, lexer.WithLine(len(history)))
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+			printParseErrors(out, strings.Join(history, "\n"), p.ParserErrors())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		if showAST {
+			io.WriteString(out, ast.Sexpr(program)+"\n")
+			continue
+		}
+
+		snapshots = append(snapshots, env.Snapshot())
+
+		// ctrl-c stops a runaway line rather than the whole session
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		evaluated := eval.EvalCtx(ctx, program, env)
+		stop()
 
-		io.WriteString(out, evaluated.Inspect())
+		if err, ok := evaluated.(*object.Error); ok {
+			pos := token.Position{Line: err.Line, Column: err.Column}
+			io.WriteString(out, diagnostics.Render(strings.Join(history, "\n"), pos, err.Traceback()))
+		} else {
+			io.WriteString(out, evaluated.Inspect())
+		}
 		io.WriteString(out, "\n")
 	}
 }
 
-func printParseErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func reload(out io.Writer, eval *evaluator.Evaluator, env *object.Environment, file string) {
+	input, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+
+	p := parser.New(lexer.NewFile(file, string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(out, string(input), p.ParserErrors())
+		return
+	}
+
+	names, evaluated := eval.Reload(program, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		pos := token.Position{Line: err.Line, Column: err.Column}
+		io.WriteString(out, diagnostics.Render(string(input), pos, file+": "+err.Traceback())+"\n")
+		return
+	}
+	if len(names) == 0 {
+		io.WriteString(out, "nothing changed\n")
+		return
+	}
+	io.WriteString(out, "reloaded "+strings.Join(names, ", ")+"\n")
+}
+
+func printParseErrors(out io.Writer, source string, errors []parser.ParserError) {
+	for _, err := range errors {
+		io.WriteString(out, diagnostics.Render(source, err.Pos, err.Error())+"\n")
 	}
 }
@@ -1,14 +1,22 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type TokenType string
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // only emitted by lexers created with lexer.WithComments
 
 	// identifiers and literals
 	IDENT = "IDENT"
 	INT   = "INT"
+	FLOAT = "FLOAT"
 
 	// operators
 	ASSIGN   = "="
@@ -18,11 +26,26 @@ const (
 	SLASH    = "/"
 	BANG     = "!"
 
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND  = "&&"
+	OR   = "||"
+	PIPE = "|>"
+
+	DOT            = "."
+	OPTIONAL_CHAIN = "?."
+	SPREAD         = "..."
+
 	// delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -43,19 +66,39 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	THROW    = "THROW"
+	DELAY    = "DELAY"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	ENUM     = "ENUM"
 
 	// extension datatypes
 	STRING = "STRING"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"try":      TRY,
+	"catch":    CATCH,
+	"throw":    THROW,
+	"delay":    DELAY,
+	"yield":    YIELD,
+	"spawn":    SPAWN,
+	"enum":     ENUM,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -68,4 +111,62 @@ func LookupIdent(ident string) TokenType {
 type Token struct {
 	Type    TokenType
 	Literal string
+	File    string // name of the source file, empty for e.g. the REPL
+	Line    int    // 1-based line of the first char of the token
+	Column  int    // 1-based column of the first char of the token
+}
+
+// a place in the source; the zero value is an unknown position
+type Position struct {
+	File   string
+	Line   int // 1-based
+	Column int // 1-based, counted in bytes
+}
+
+// String formats the position as file:line:column, leaving out the file when
+// it isn't known
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || (p.Line == other.Line && p.Column < other.Column)
+}
+
+// Pos is the position of the first char of the token
+func (t Token) Pos() Position {
+	return Position{File: t.File, Line: t.Line, Column: t.Column}
+}
+
+// End is the position just after the last char of the token
+func (t Token) End() Position {
+	literal := t.Literal
+	if t.Type == STRING {
+		// the quotes aren't part of the literal
+		literal = `"` + literal + `"`
+	}
+
+	end := t.Pos()
+	if i := strings.LastIndexByte(literal, '\n'); i >= 0 {
+		end.Line += strings.Count(literal, "\n")
+		end.Column = len(literal) - i
+	} else {
+		end.Column += len(literal)
+	}
+	return end
+}
+
+// Keywords returns the reserved words of the language
+func Keywords() []string {
+	words := []string{}
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }